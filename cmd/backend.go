@@ -8,10 +8,8 @@ import (
 	"time"
 
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 
 	"github.com/pgillich/opentracing-example/internal"
-	"github.com/pgillich/opentracing-example/internal/logger"
 )
 
 // backendCmd represents the backend command
@@ -33,10 +31,9 @@ func init() {
 	rootCmd.AddCommand(backendCmd)
 	backendCmd.Flags().String("listenaddr", "localhost:8881", "Listen address")
 	backendCmd.Flags().String("instance", "#2", "Backend instance")
-	backendCmd.Flags().String("jaegerURL", "http://localhost:14268/api/traces", "Jaeger collector address")
+	addTracingFlags(backendCmd.Flags())
+	backendCmd.Flags().Int("spanStoreSize", 0, "Number of spans kept in memory for /debug/traces (0: disabled)")
+	backendCmd.Flags().Bool("spanMetrics", false, "Derive RED and service graph metrics from the spans")
+	backendCmd.Flags().Bool("adminEndpoints", false, "Enable the /admin endpoints on the listen address (no authentication)")
 	backendCmd.Flags().String("response", "Hello", "Response text")
-	if err := viper.BindPFlags(backendCmd.Flags()); err != nil {
-		logger.GetLogger(backendCmd.Use).Error(err, "Unable to bind flags")
-		panic(err)
-	}
 }
@@ -8,10 +8,8 @@ import (
 	"time"
 
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 
 	"github.com/pgillich/opentracing-example/internal"
-	"github.com/pgillich/opentracing-example/internal/logger"
 )
 
 // frontendCmd represents the frontend command
@@ -33,9 +31,31 @@ func init() {
 	rootCmd.AddCommand(frontendCmd)
 	frontendCmd.Flags().String("listenaddr", "localhost:8882", "Listen address")
 	frontendCmd.Flags().String("instance", "#0", "Frontend instance")
-	frontendCmd.Flags().String("jaegerURL", "http://localhost:14268/api/traces", "Jaeger collector address")
-	if err := viper.BindPFlags(frontendCmd.Flags()); err != nil {
-		logger.GetLogger(frontendCmd.Use).Error(err, "Unable to bind flags")
-		panic(err)
-	}
+	addTracingFlags(frontendCmd.Flags())
+	frontendCmd.Flags().Int("spanStoreSize", 0, "Number of spans kept in memory for /debug/traces (0: disabled)")
+	frontendCmd.Flags().Bool("spanMetrics", false, "Derive RED and service graph metrics from the spans")
+	frontendCmd.Flags().Bool("adminEndpoints", false, "Enable the /admin endpoints on the listen address (no authentication)")
+	frontendCmd.Flags().Int64("maxRequestBody", 1<<20, "Maximum size of the JSON /proxy request in bytes")
+	frontendCmd.Flags().Int("maxParallel", 4, "Maximum number of the concurrent backend calls of a /proxy request (0: unlimited)")
+	frontendCmd.Flags().Duration("backendTimeout", 10*time.Second, "Timeout of a backend call (0: none)")
+	frontendCmd.Flags().Duration("proxyTimeout", 30*time.Second, "Timeout of all backend calls of a /proxy request (0: none)")
+	frontendCmd.Flags().Int("retryMaxAttempts", 1, "Maximum number of the attempts of a backend call (1: no retry)")
+	frontendCmd.Flags().Duration("retryBackoff", 100*time.Millisecond, "First backoff of the retries, doubled at every retry (with jitter)")
+	frontendCmd.Flags().Duration("retryMaxBackoff", 2*time.Second, "Maximum backoff of the retries")
+	frontendCmd.Flags().IntSlice("retryOn", []int{502, 503, 504}, "Retryable response status codes")
+	frontendCmd.Flags().Bool("retryNetworkErrors", true, "Retry on the errors without response (connection refused, timeout)")
+	frontendCmd.Flags().Bool("retryNonIdempotent", false, "Retry the non-idempotent methods without Idempotency-Key header")
+	frontendCmd.Flags().Int("breakerFailures", 0, "Consecutive failures, which open the circuit breaker of a backend host (0: disabled)")
+	frontendCmd.Flags().Duration("breakerOpenTimeout", 30*time.Second, "Time of the open circuit breaker state, before half-open")
+	frontendCmd.Flags().Int("breakerHalfOpenProbes", 1, "Successful half-open calls, which close the circuit breaker")
+	frontendCmd.Flags().StringSlice("allowSchemes", []string{"http", "https"}, "Allowed schemes of the backend calls (empty: all)")
+	frontendCmd.Flags().StringSlice("allowHosts", []string{}, "Allowed hosts of the backend calls, *.example.com for subdomains (empty: all)")
+	frontendCmd.Flags().StringSlice("allowCIDRs", []string{}, "Allowed addresses of the backend calls, checked after DNS resolution (empty: all)")
+	frontendCmd.Flags().IntSlice("allowPorts", []int{}, "Allowed ports of the backend calls (empty: all)")
+	frontendCmd.Flags().StringSlice("denyHosts", []string{"metadata.google.internal"}, "Denied hosts of the backend calls, *.example.com for subdomains")
+	frontendCmd.Flags().StringSlice("denyCIDRs", []string{
+		"127.0.0.0/8", "::1", "0.0.0.0/8", "::", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7",
+		"169.254.0.0/16", "fe80::/10", "fd00:ec2::254", "100.100.100.200",
+	}, "Denied addresses of the backend calls (loopback, unspecified, private, link-local and cloud metadata by default), checked after DNS resolution")
+	frontendCmd.Flags().IntSlice("denyPorts", []int{}, "Denied ports of the backend calls")
 }
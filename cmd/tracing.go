@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"github.com/pgillich/opentracing-example/internal/tracing"
+)
+
+// addTracingFlags adds the flags of tracing.Config
+func addTracingFlags(flags *pflag.FlagSet) {
+	flags.String("jaegerURL", "http://localhost:14268/api/traces", "Jaeger collector address (legacy, used if exporterURL is empty and the exporter is not OTLP)")
+	flags.String("exporter", tracing.ExporterAuto,
+		"Span exporter: otlpgrpc, otlphttp, otlphttpjson, jaeger or none (default: selected by the scheme of the URL)",
+	)
+	flags.String("exporterURL", "",
+		"Collector address, for example grpc://localhost:4317, otlp+http://localhost:4318, otlp+json://localhost:4318",
+	)
+	flags.StringSlice("exporterHeaders", []string{}, "Headers of the export requests (key=value)")
+	flags.String("exporterCompression", tracing.CompressionNone, "Compression of the export requests: gzip or none")
+	flags.Bool("exporterInsecure", false, "Disable TLS to the collector")
+	flags.Bool("exporterTLSSkipVerify", false, "Skip the verification of the collector certificate")
+	flags.String("exporterCAFile", "", "CA certificate file of the collector")
+	flags.String("exporterCertFile", "", "Client certificate file to the collector")
+	flags.String("exporterKeyFile", "", "Client key file to the collector")
+	flags.Duration("exportBatchTimeout", 5*time.Second, "Max delay of the export of an ended span (batch timeout)")
+	flags.StringSlice("resourceAttr", []string{}, "Extra resource attributes (key=value), override the detected and OTEL_RESOURCE_ATTRIBUTES attributes")
+	flags.String("exportQueueDir", "", "Directory of the persistent export queue, the failed exports are spooled and replayed (empty: disabled)")
+	flags.Int("exportQueueMaxBatches", 1000, "Max number of the spooled batches, the oldest is dropped, if it's exceeded (0: unlimited)")
+	flags.Duration("exportQueueRetryMin", time.Second, "Initial wait between the replays of the export queue")
+	flags.Duration("exportQueueRetryMax", time.Minute, "Max wait between the replays of the export queue")
+	flags.String("sampler", tracing.SamplerParentBasedAlwaysOn,
+		"Sampler: always_on, always_off, traceidratio:RATIO, ratelimit:PER_SECOND, or parentbased_ variants",
+	)
+	flags.StringSlice("samplerRules", []string{},
+		"Sampler rules by HTTP method and chi route pattern (METHOD ROUTE=SAMPLER), for example: 'GET /ping=traceidratio:0.01'",
+	)
+	flags.StringSlice("propagators", []string{},
+		"Propagators: tracecontext, baggage, b3, b3multi, jaeger, xray, ottrace, none (default: $OTEL_PROPAGATORS or tracecontext,baggage)",
+	)
+	flags.Bool("openTracingBridge", false, "Install the OpenTracing bridge as the global OpenTracing tracer (for opentracing-go instrumented code)")
+	flags.StringSlice("baggageAttributes", []string{}, "Baggage keys copied onto the spans as attributes (* for all), for example: baggID,baggCommand")
+	flags.String("baggageAttributePrefix", tracing.DefaultBaggageAttributePrefix, "Prefix of the span attributes copied from the baggage")
+	flags.StringSlice("redactQueryParams", []string{}, "Query parameters to be masked in the spans (* for all)")
+	flags.StringSlice("redactHeaders", []string{}, "HTTP headers to be masked in the http.request.header.* and http.response.header.* span attributes")
+	flags.StringSlice("redactAttributes", []string{}, "Regexps of the span attribute and tracestate keys to be masked")
+	flags.StringSlice("allowAttributes", []string{}, "Regexps of the span attribute keys, which are not masked (default: all)")
+	flags.Bool("tailSampling", false, "Export only the traces with error, high latency or matching attributes")
+	flags.Duration("tailSamplingLatency", 0, "Tail sampling: keep the traces having a span longer than this (0: disabled)")
+	flags.StringSlice("tailSamplingAttributes", []string{},
+		"Tail sampling: keep the traces having a span with matching attribute (key=value or key=* or key)",
+	)
+	flags.Duration("tailSamplingDecisionWait", 5*time.Second, "Tail sampling: max wait for the local root span")
+	flags.Int("tailSamplingMaxTraces", 1000, "Tail sampling: max number of buffered traces")
+	flags.Int("tailSamplingMaxSpans", 1000, "Tail sampling: max number of buffered spans in a trace")
+}
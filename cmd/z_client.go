@@ -9,11 +9,10 @@ import (
 	"time"
 
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 
 	"github.com/pgillich/opentracing-example/internal"
-	"github.com/pgillich/opentracing-example/internal/logger"
 	"github.com/pgillich/opentracing-example/internal/model"
+	"github.com/pgillich/opentracing-example/internal/tracing"
 )
 
 // clientCmd represents the client command
@@ -37,9 +36,7 @@ func init() {
 	rootCmd.AddCommand(clientCmd)
 	clientCmd.Flags().String("server", "localhost:8882", "FE server address")
 	clientCmd.Flags().String("instance", "#3", "Client instance")
-	clientCmd.Flags().String("jaegerURL", "http://localhost:14268/api/traces", "Jaeger collector address")
-	if err := viper.BindPFlags(clientCmd.Flags()); err != nil {
-		logger.GetLogger(clientCmd.Use).Error(err, "Unable to bind flags")
-		panic(err)
-	}
+	clientCmd.Flags().String("traceURL", "http://localhost:16686/trace/"+tracing.TraceURLTraceID, "Trace UI link template, {traceID} is replaced")
+	clientCmd.Flags().String("scenario", "", "Call tree file (YAML or JSON) sent to /proxy instead of the URL args")
+	addTracingFlags(clientCmd.Flags())
 }
@@ -14,6 +14,7 @@ import (
 
 	"github.com/pgillich/opentracing-example/internal/logger"
 	"github.com/pgillich/opentracing-example/internal/model"
+	"github.com/pgillich/opentracing-example/internal/tracing"
 )
 
 var cfgFile string //nolint:gochecknoglobals // cobra
@@ -31,6 +32,36 @@ to quickly create a Cobra application.`,
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	// Run: func(cmd *cobra.Command, args []string) { },
+
+	// The subcommands have flags with the same name (for example: instance),
+	// so only the flags of the running command can be bound.
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := viper.BindPFlags(cmd.Flags()); err != nil {
+			return errors.Wrap(err, "unable to bind flags")
+		}
+
+		logExport := viper.GetString("log-export")
+		logExporter, err := tracing.NewLogExporter(logExport, viper.GetString("log-export-url"))
+		if err != nil {
+			return err
+		}
+
+		if err = logger.Configure(logger.Config{
+			Level:      viper.GetString("log-level"),
+			Format:     viper.GetString("log-format"),
+			Levels:     viper.GetStringSlice("log-levels"),
+			SpanEvents: logExport == logger.ExportSpan,
+			Exporter:   logExporter,
+		}); err != nil {
+			if logExporter != nil {
+				logExporter.Shutdown(context.Background()) //nolint:errcheck,gosec // not used
+			}
+
+			return errors.Wrap(err, "invalid log config")
+		}
+
+		return nil
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -46,6 +77,11 @@ func Execute(ctx context.Context, args []string, serverRunner model.ServerRunner
 	}
 }
 
+// RootCmd returns the root command, for example to reset the flags between the Execute calls of the tests
+func RootCmd() *cobra.Command {
+	return rootCmd
+}
+
 func init() {
 	cobra.OnInitialize(initConfig)
 
@@ -54,6 +90,11 @@ func init() {
 	// will be global for your application.
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.opentracing-example.yaml)")
+	rootCmd.PersistentFlags().String("log-level", logger.DefaultLevel, "Log level: trace, debug (V(1) logs), info, warn or error")
+	rootCmd.PersistentFlags().String("log-format", logger.DefaultFormat, "Log format: text, json or logfmt")
+	rootCmd.PersistentFlags().StringSlice("log-levels", []string{}, "Log level overrides by logger name, for example: backend=debug")
+	rootCmd.PersistentFlags().String("log-export", logger.ExportNone, "Log forwarding: none, span (span events), otlphttp or otlphttpjson")
+	rootCmd.PersistentFlags().String("log-export-url", tracing.DefaultLogExportURL, "OTLP/HTTP logs URL")
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
@@ -75,7 +116,8 @@ func initConfig() {
 		viper.SetConfigName(".opentracing-example")
 	}
 
-	viper.AutomaticEnv() // read in environment variables that match
+	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_")) // for example: log-level -> LOG_LEVEL
+	viper.AutomaticEnv()                                   // read in environment variables that match
 
 	// If a config file is found, read it in.
 	if err := viper.ReadInConfig(); err == nil {
@@ -93,5 +135,11 @@ func RunService(ctx context.Context, serviceType string, args []string, config i
 
 	log.WithValues("config", config, "type", serviceType).Info("Running...")
 
+	defer func() {
+		if err := logger.Flush(context.Background()); err != nil {
+			log.Error(err, "unable to flush logs")
+		}
+	}()
+
 	return errors.Wrap(newService(ctx, config, log).Run(args), "service run")
 }
@@ -8,7 +8,7 @@ import (
 	"github.com/go-chi/chi/v5"
 	chi_middleware "github.com/go-chi/chi/v5/middleware"
 	"github.com/go-logr/logr"
-	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"github.com/opentracing/opentracing-go"
 	"go.opentelemetry.io/otel/trace"
 
 	"github.com/pgillich/opentracing-example/internal/logger"
@@ -16,11 +16,19 @@ import (
 	"github.com/pgillich/opentracing-example/internal/tracing"
 )
 
+// BackendServiceName is the service.name of the backend
+const BackendServiceName = "backend.opentracing-example"
+
 type BackendConfig struct {
 	ListenAddr string
 	Instance   string
 	Command    string
-	JaegerURL  string
+
+	tracing.Config `mapstructure:",squash"`
+	SpanStoreSize  int
+	SpanMetrics    bool
+	// AdminEndpoints enables the /admin endpoints on the listen address
+	AdminEndpoints bool
 
 	Response string
 }
@@ -33,10 +41,6 @@ func (c *BackendConfig) SetInstance(instance string) {
 	c.Instance = instance
 }
 
-func (c *BackendConfig) SetJaegerURL(url string) {
-	c.JaegerURL = url
-}
-
 func (c *BackendConfig) SetCommand(command string) {
 	c.Command = command
 }
@@ -81,12 +85,51 @@ func (s *Backend) Run(args []string) error {
 	}
 	s.log.WithValues("config", s.config).Info("Backend start")
 
-	traceExporter, err := tracing.JaegerProvider(s.config.JaegerURL)
+	traceExporter, err := tracing.NewExporter(context.Background(), s.config.Config)
+	if err != nil {
+		return err
+	}
+	sampler, err := tracing.NewSampler(s.config.Sampler, s.config.SamplerRules)
+	if err != nil {
+		return err
+	}
+	propagator, err := tracing.NewPropagator(s.config.Propagators)
+	if err != nil {
+		return err
+	}
+	tracerOptions, err := s.config.TracerOptions(s.log)
+	if err != nil {
+		return err
+	}
+	tracerOptions = append(tracerOptions, tracing.WithPropagator(propagator))
+	mp, metricsRegistry, err := tracing.InitMeter(BackendServiceName, s.config.Instance)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := mp.Shutdown(context.Background()); err != nil {
+			s.log.Error(err, "Error shutting down meter provider")
+		}
+	}()
+	meter := mp.Meter("github.com/pgillich/opentracing-example/backend")
+	httpMetrics, err := tracing.NewHTTPMetrics(meter, metricsRegistry)
 	if err != nil {
 		return err
 	}
-	tp := tracing.InitTracer(traceExporter, sdktrace.AlwaysSample(),
-		"backend.opentracing-example", s.config.Instance, "", s.log,
+	if s.config.SpanMetrics {
+		spanMetrics, err := tracing.NewSpanMetricsProcessor(meter) //nolint:govet // err shadow
+		if err != nil {
+			return err
+		}
+		tracerOptions = append(tracerOptions, tracing.WithSpanProcessor(spanMetrics))
+	}
+	var spanStore *tracing.SpanStore
+	if s.config.SpanStoreSize > 0 {
+		spanStore = tracing.NewSpanStore(s.config.SpanStoreSize)
+		tracerOptions = append(tracerOptions, tracing.WithSpanProcessor(spanStore))
+	}
+	tp := tracing.InitTracer(traceExporter, sampler,
+		BackendServiceName, s.config.Instance, "", s.log, tracerOptions...,
 	)
 	defer func() {
 		if err := tp.Shutdown(context.Background()); err != nil {
@@ -103,24 +146,34 @@ func (s *Backend) Run(args []string) error {
 	r := chi.NewRouter()
 	r.Use(chi_middleware.RequestLogger(&logger.ChiLogr{Logger: s.log}))
 	r.Use(chi_middleware.Recoverer)
-	r.Use(tracing.ChiTracerMiddleware(tr, s.config.Instance, s.log))
-
-	r.Get("/ping", func(w http.ResponseWriter, r *http.Request) {
-		ctx := r.Context()
-		span := trace.SpanFromContext(ctx)
-		defer func() {
-			spanText, _ := span.SpanContext().MarshalJSON() //nolint:errcheck // not important
-			s.log.WithValues(
-				"service", "backend",
-				"span", string(spanText),
-			).Info("Span END")
-			span.End()
-			tp.ForceFlush(context.Background()) //nolint:errcheck,gosec // not important
-		}()
-
-		if _, err := w.Write([]byte(s.config.Response + hostname)); err != nil {
-			s.log.Error(err, "unable to send response")
-		}
+	r.Handle(tracing.MetricsPath, tracing.MetricsHandler(metricsRegistry, s.log))
+	if s.config.AdminEndpoints {
+		r.Handle(logger.AdminLogLevelPath, logger.LevelHandler())
+	}
+	if spanStore != nil {
+		r.Mount("/debug/traces", spanStore.Handler())
+	}
+
+	r.Group(func(r chi.Router) {
+		r.Use(tracing.ChiTracerMiddleware(tr, propagator, BackendServiceName, s.config.Instance, s.log))
+		r.Use(httpMetrics.Middleware)
+		r.Get("/ping", func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			span := trace.SpanFromContext(ctx)
+			log := logger.FromContext(ctx, s.log)
+			defer func() {
+				spanText, _ := span.SpanContext().MarshalJSON() //nolint:errcheck // not important
+				log.WithValues(
+					"service", "backend",
+					"span", string(spanText),
+				).V(1).Info("Span END")
+				span.End()
+			}()
+
+			if _, err := w.Write([]byte(s.buildResponse(ctx, hostname))); err != nil {
+				log.Error(err, "unable to send response")
+			}
+		})
 	})
 	h = r
 
@@ -130,6 +183,19 @@ func (s *Backend) Run(args []string) error {
 	return nil
 }
 
+/*
+buildResponse is an example of the legacy code, instrumented by opentracing-go.
+If the OpenTracing bridge is enabled (--openTracingBridge), the span is a child of the server span.
+*/
+func (s *Backend) buildResponse(ctx context.Context, hostname string) string {
+	span, _ := opentracing.StartSpanFromContext(ctx, "buildResponse")
+	defer span.Finish()
+	span.SetTag("response.prefix", s.config.Response)
+	span.LogKV("event", "hostname", "hostname", hostname)
+
+	return s.config.Response + hostname
+}
+
 /*
 	// ECHO
 
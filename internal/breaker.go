@@ -0,0 +1,285 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/pgillich/opentracing-example/internal/logger"
+	"github.com/pgillich/opentracing-example/internal/model"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	AdminBreakersPath = "/admin/breakers"
+
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+
+	SpanKeyBreakerHost  = attribute.Key("breaker.host")
+	SpanKeyBreakerState = attribute.Key("breaker.state")
+	SpanKeyBreakerFrom  = attribute.Key("breaker.from")
+
+	// maxBreakers limits the number of the breakers, see circuitBreakers.evict
+	maxBreakers = 1000
+)
+
+var ErrCircuitOpen = errors.NewPlain("circuit breaker is open")
+
+// BreakerState is the state of the circuit breaker of a backend host, see AdminBreakersPath
+type BreakerState struct {
+	Host     string    `json:"host"`
+	State    string    `json:"state"`
+	Failures int       `json:"failures"`
+	Since    time.Time `json:"since"`
+}
+
+// BreakersResponse is the response of AdminBreakersPath
+type BreakersResponse struct {
+	Breakers []BreakerState `json:"breakers"`
+}
+
+type breakerTransition struct {
+	host string
+	from string
+	to   string
+}
+
+/*
+circuitBreakers has a circuit breaker for each backend host:
+
+	closed     the calls are sent, failureThreshold consecutive failures open the breaker
+	open       the calls are short-circuited (ErrCircuitOpen), the breaker is half-open after openTimeout
+	half-open  at most halfOpenProbes calls are sent, a failure opens, halfOpenProbes successes close the breaker
+
+A failure is an error without response or a 5xx status, see isBreakerFailure. The breakers are disabled, if failureThreshold is 0.
+At most maxBreakers hosts are tracked, see evict.
+*/
+type circuitBreakers struct {
+	failureThreshold int
+	openTimeout      time.Duration
+	halfOpenProbes   int
+
+	mu       sync.Mutex
+	breakers map[string]*circuitBreaker
+}
+
+type circuitBreaker struct {
+	state     string
+	failures  int
+	successes int
+	probes    int
+	since     time.Time
+}
+
+func newCircuitBreakers(failureThreshold int, openTimeout time.Duration, halfOpenProbes int) *circuitBreakers {
+	if halfOpenProbes <= 0 {
+		halfOpenProbes = 1
+	}
+
+	return &circuitBreakers{
+		failureThreshold: failureThreshold,
+		openTimeout:      openTimeout,
+		halfOpenProbes:   halfOpenProbes,
+		breakers:         map[string]*circuitBreaker{},
+	}
+}
+
+/*
+allow returns true, if the call can be sent, probe is true, if the call is a half-open probe,
+and state is the state of the breaker (a half-open breaker short-circuits the calls over halfOpenProbes)
+*/
+func (b *circuitBreakers) allow(host string) (allowed bool, probe bool, state string, transition *breakerTransition) {
+	if b.failureThreshold <= 0 {
+		return true, false, BreakerClosed, nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	breaker := b.get(host)
+	if breaker.state == BreakerOpen && time.Since(breaker.since) >= b.openTimeout {
+		transition = b.setState(host, breaker, BreakerHalfOpen)
+	}
+	switch breaker.state {
+	case BreakerOpen:
+		return false, false, breaker.state, transition
+	case BreakerHalfOpen:
+		if breaker.probes >= b.halfOpenProbes {
+			return false, false, breaker.state, transition
+		}
+		breaker.probes++
+
+		return true, true, breaker.state, transition
+	default:
+		return true, false, breaker.state, transition
+	}
+}
+
+// record registers the result of a sent call, the results of the non-probe calls are ignored, if the breaker is not closed
+func (b *circuitBreakers) record(host string, probe bool, success bool) *breakerTransition {
+	if b.failureThreshold <= 0 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	breaker := b.get(host)
+	switch {
+	case breaker.state == BreakerClosed && success:
+		breaker.failures = 0
+	case breaker.state == BreakerClosed:
+		breaker.failures++
+		if breaker.failures >= b.failureThreshold {
+			return b.setState(host, breaker, BreakerOpen)
+		}
+	case breaker.state == BreakerHalfOpen && probe:
+		breaker.probes--
+		if !success {
+			breaker.failures++
+
+			return b.setState(host, breaker, BreakerOpen)
+		}
+		breaker.successes++
+		if breaker.successes >= b.halfOpenProbes {
+			return b.setState(host, breaker, BreakerClosed)
+		}
+	}
+
+	return nil
+}
+
+func (b *circuitBreakers) get(host string) *circuitBreaker {
+	breaker, has := b.breakers[host]
+	if !has {
+		if len(b.breakers) >= maxBreakers {
+			b.evict()
+		}
+		breaker = &circuitBreaker{state: BreakerClosed, since: time.Now()}
+		b.breakers[host] = breaker
+	}
+
+	return breaker
+}
+
+/*
+evict removes the closed breakers without failures (same as a new breaker),
+and the breaker with the oldest state change, if the number of the breakers is still maxBreakers
+*/
+func (b *circuitBreakers) evict() {
+	oldest := ""
+	for host, breaker := range b.breakers {
+		if breaker.state == BreakerClosed && breaker.failures == 0 {
+			delete(b.breakers, host)
+		} else if oldest == "" || breaker.since.Before(b.breakers[oldest].since) {
+			oldest = host
+		}
+	}
+	if len(b.breakers) >= maxBreakers {
+		delete(b.breakers, oldest)
+	}
+}
+
+func (b *circuitBreakers) setState(host string, breaker *circuitBreaker, state string) *breakerTransition {
+	transition := &breakerTransition{host: host, from: breaker.state, to: state}
+	breaker.state = state
+	breaker.since = time.Now()
+	breaker.successes = 0
+	breaker.probes = 0
+	if state == BreakerClosed {
+		breaker.failures = 0
+	}
+
+	return transition
+}
+
+func (b *circuitBreakers) states() []BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	states := make([]BreakerState, 0, len(b.breakers))
+	for host, breaker := range b.breakers {
+		states = append(states, BreakerState{Host: host, State: breaker.state, Failures: breaker.failures, Since: breaker.since})
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Host < states[j].Host })
+
+	return states
+}
+
+// Handler returns the states of the breakers (GET)
+func (b *circuitBreakers) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(BreakersResponse{Breakers: b.states()}) //nolint:errcheck,gosec // not important
+	})
+}
+
+// backendHost returns the host (and port) of the target, the breakers are keyed by it
+func backendHost(target string) string {
+	if u, err := url.Parse(target); err == nil && u.Host != "" {
+		return u.Host
+	}
+
+	return target
+}
+
+/*
+isBreakerFailure returns true for the errors without response and the 5xx statuses, except the failures caused by the caller:
+the denied targets, the timeout of the call (set by the caller) and the done parent context (proxy timeout, cancelled request).
+*/
+func isBreakerFailure(ctx context.Context, call model.ProxyCall, result backendResult) bool {
+	if result.err == nil || ctx.Err() != nil || errors.Is(result.err, ErrTargetDenied) {
+		return false
+	}
+	if call.Timeout > 0 && errors.Is(result.err, context.DeadlineExceeded) {
+		return false
+	}
+
+	return result.status == 0 || result.status >= http.StatusInternalServerError
+}
+
+// logTransition logs the state change of the breaker and adds it as an event to the active span
+func (s *Frontend) logTransition(ctx context.Context, transition *breakerTransition) {
+	if transition == nil {
+		return
+	}
+	logger.FromContext(ctx, s.log).Info("Circuit breaker state change",
+		"host", transition.host, "from", transition.from, "to", transition.to,
+	)
+	trace.SpanFromContext(ctx).AddEvent("circuit breaker "+transition.to, trace.WithAttributes(
+		SpanKeyBreakerHost.String(transition.host),
+		SpanKeyBreakerFrom.String(transition.from),
+		SpanKeyBreakerState.String(transition.to),
+	))
+}
+
+// shortCircuit returns the ErrCircuitOpen result of the call with a client span, which has error status and the state of the breaker
+func (s *Frontend) shortCircuit(ctx context.Context, call model.ProxyCall, host string, state string) backendResult {
+	method := callMethod(call)
+	_, span := s.tracer.Start(ctx, "HTTP "+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPMethodKey.String(method),
+			semconv.HTTPURLKey.String(call.Target),
+			SpanKeyBreakerHost.String(host),
+			SpanKeyBreakerState.String(state),
+		),
+	)
+	defer span.End()
+	span.SetStatus(codes.Error, ErrCircuitOpen.Error())
+
+	return backendResult{
+		err:    errors.WithDetails(ErrCircuitOpen, "url", call.Target, "host", host, "state", state),
+		spanID: span.SpanContext().SpanID().String(),
+	}
+}
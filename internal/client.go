@@ -1,30 +1,39 @@
 package internal
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"io"
 	"net/http"
 	"os"
 	"strings"
 
+	"emperror.dev/errors"
 	"github.com/go-logr/logr"
 	"github.com/pgillich/opentracing-example/internal/logger"
 	"github.com/pgillich/opentracing-example/internal/model"
 	"github.com/pgillich/opentracing-example/internal/tracing"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
-	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/baggage"
-	sdktrace "go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.11.0"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
 	"go.opentelemetry.io/otel/trace"
 )
 
+// ClientServiceName is the service.name of the client
+const ClientServiceName = "client.opentracing-example"
+
 type ClientConfig struct {
-	Server    string
-	Instance  string
-	Command   string
-	JaegerURL string
+	Server   string
+	Instance string
+	Command  string
+	// TraceURL is the link template of the trace UI, {traceID} is replaced
+	TraceURL string
+	// Scenario is the file of the call tree (YAML or JSON), the URL args are ignored, see model.ParseProxyScenario
+	Scenario string
+
+	tracing.Config `mapstructure:",squash"`
 }
 
 type Client struct {
@@ -49,15 +58,28 @@ func NewClientService(ctx context.Context, cfg interface{}, log logr.Logger) mod
 func (c *Client) Run(args []string) error {
 	c.log.WithValues("config", c.config).Info("Client start")
 
-	traceExporter, err := tracing.JaegerProvider(c.config.JaegerURL)
+	traceExporter, err := tracing.NewExporter(context.Background(), c.config.Config)
+	if err != nil {
+		return err
+	}
+	sampler, err := tracing.NewSampler(c.config.Sampler, c.config.SamplerRules)
+	if err != nil {
+		return err
+	}
+	propagator, err := tracing.NewPropagator(c.config.Propagators)
 	if err != nil {
 		return err
 	}
 	if c.config.Instance == "-" {
 		c.config.Instance, _ = os.Hostname() //nolint:errcheck // not important
 	}
-	tp := tracing.InitTracer(traceExporter, sdktrace.AlwaysSample(),
-		"client.opentracing-example", c.config.Instance, c.config.Command, c.log,
+	tracerOptions, err := c.config.TracerOptions(c.log)
+	if err != nil {
+		return err
+	}
+	tracerOptions = append(tracerOptions, tracing.WithPropagator(propagator))
+	tp := tracing.InitTracer(traceExporter, sampler,
+		ClientServiceName, c.config.Instance, c.config.Command, c.log, tracerOptions...,
 	)
 	defer func() {
 		//nolint:govet // local err
@@ -67,7 +89,7 @@ func (c *Client) Run(args []string) error {
 	}()
 	httpClient := &http.Client{Transport: otelhttp.NewTransport(
 		http.DefaultTransport,
-		otelhttp.WithPropagators(otel.GetTextMapPropagator()),
+		otelhttp.WithPropagators(propagator),
 		otelhttp.WithSpanOptions(trace.WithAttributes(
 			attribute.String(tracing.SpanKeyComponent, tracing.SpanKeyComponentValue),
 		)),
@@ -78,6 +100,10 @@ func (c *Client) Run(args []string) error {
 
 	traceState := trace.TraceState{}
 	traceState, err = traceState.Insert(tracing.StateKeyClientCommand, tracing.EncodeTracestateValue(c.config.Command))
+	if err == nil {
+		// the frontend records the service graph edge from the client, see tracing.SpanMetricsProcessor
+		traceState, err = traceState.Insert(tracing.StateKeyClientService, tracing.EncodeTracestateValue(ClientServiceName))
+	}
 	if err != nil {
 		c.log.Error(err, "unable to set command in state")
 	} else {
@@ -98,21 +124,27 @@ func (c *Client) Run(args []string) error {
 		trace.WithAttributes(semconv.PeerServiceKey.String("ExampleClientService")),
 		trace.WithSpanKind(trace.SpanKindClient),
 	)
+	c.log = logger.WithSpan(c.log, span)
 	defer func() {
 		spanText, _ := span.SpanContext().MarshalJSON() //nolint:errcheck // not important
 		c.log.WithValues(
 			"service", "client",
 			"span", string(spanText),
-		).Info("Span END")
+		).V(1).Info("Span END")
 		span.End()
-		tp.ForceFlush(context.Background()) //nolint:errcheck,gosec // not important
 	}()
 
-	return c.run(ctx, httpClient, strings.Join(args, " "))
+	if err := c.run(ctx, httpClient, args); err != nil {
+		tracing.RecordError(span, err)
+
+		return err
+	}
+
+	return nil
 }
 
-func (c *Client) run(ctx context.Context, httpClient *http.Client, reqBody string) error {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+c.config.Server+"/proxy", strings.NewReader(reqBody))
+func (c *Client) run(ctx context.Context, httpClient *http.Client, args []string) error {
+	req, err := c.newProxyRequest(ctx, args)
 	if err != nil {
 		return err
 	}
@@ -127,7 +159,55 @@ func (c *Client) run(ctx context.Context, httpClient *http.Client, reqBody strin
 	if resp.Body != nil {
 		defer resp.Body.Close() //nolint:errcheck // not needed
 	}
+	c.logTraceResponse(resp)
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return errors.WithDetails(ErrBackendResponse, "status", resp.StatusCode, "body", string(body))
+	}
 	c.log.Info("Client resp", "body", string(body))
 
 	return nil
 }
+
+/*
+newProxyRequest creates the /proxy request: the legacy text request of the URL args,
+or the JSON request of the scenario file, see model.ParseProxyScenario.
+*/
+func (c *Client) newProxyRequest(ctx context.Context, args []string) (*http.Request, error) {
+	proxyURL := "http://" + c.config.Server + "/proxy"
+	if c.config.Scenario == "" {
+		return http.NewRequestWithContext(ctx, http.MethodGet, proxyURL, strings.NewReader(strings.Join(args, " ")))
+	}
+
+	scenario, err := os.ReadFile(c.config.Scenario)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read scenario")
+	}
+	proxyRequest, err := model.ParseProxyScenario(scenario)
+	if err != nil {
+		return nil, err
+	}
+	reqBody, err := json.Marshal(proxyRequest)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to encode scenario")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, proxyURL, bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return req, nil
+}
+
+// logTraceResponse prints the trace ID, the trace UI link and the server timings of the response
+func (c *Client) logTraceResponse(resp *http.Response) {
+	traceID, _, ok := tracing.ParseTraceResponse(resp.Header.Get(tracing.HeaderTraceResponse))
+	if !ok {
+		return
+	}
+	c.log.Info("Client trace",
+		"traceID", traceID.String(),
+		"traceURL", strings.ReplaceAll(c.config.TraceURL, tracing.TraceURLTraceID, traceID.String()),
+		"serverTiming", resp.Header.Get(tracing.HeaderServerTiming),
+	)
+}
@@ -1,11 +1,14 @@
 package internal
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"io"
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"emperror.dev/errors"
 	"github.com/go-chi/chi/v5"
@@ -15,17 +18,60 @@ import (
 	"github.com/pgillich/opentracing-example/internal/model"
 	"github.com/pgillich/opentracing-example/internal/tracing"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
-	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
-	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"go.opentelemetry.io/otel/trace"
 )
 
+// FrontendServiceName is the service.name of the frontend
+const FrontendServiceName = "frontend.opentracing-example"
+
 type FrontendConfig struct {
 	ListenAddr string
 	Instance   string
 	Command    string
-	JaegerURL  string
+
+	tracing.Config `mapstructure:",squash"`
+	SpanStoreSize  int
+	SpanMetrics    bool
+	// AdminEndpoints enables the /admin endpoints on the listen address
+	AdminEndpoints bool
+
+	// MaxRequestBody is the maximum size of the JSON /proxy request in bytes
+	MaxRequestBody int64
+	// MaxParallel is the maximum number of the concurrent backend calls of a /proxy request (0: unlimited)
+	MaxParallel int
+	// BackendTimeout is the timeout of a backend call, ProxyTimeout is the timeout of all backend calls (0: none)
+	BackendTimeout time.Duration
+	ProxyTimeout   time.Duration
+
+	// RetryMaxAttempts is the maximum number of the attempts of a backend call (1: no retry)
+	RetryMaxAttempts int
+	// RetryBackoff is the first backoff, doubled at every retry up to RetryMaxBackoff
+	RetryBackoff    time.Duration
+	RetryMaxBackoff time.Duration
+	// RetryOn is the list of the retryable response status codes
+	RetryOn []int
+	// RetryNetworkErrors enables retry on the errors without response (for example connection refused, timeout)
+	RetryNetworkErrors bool
+	// RetryNonIdempotent enables retry of the non-idempotent methods (without Idempotency-Key header)
+	RetryNonIdempotent bool
+
+	// BreakerFailures is the number of the consecutive failures, which open the circuit breaker of a backend host (0: disabled)
+	BreakerFailures int
+	// BreakerOpenTimeout is the time of the open state, before the half-open state
+	BreakerOpenTimeout time.Duration
+	// BreakerHalfOpenProbes is the number of the calls in the half-open state, which close the circuit breaker
+	BreakerHalfOpenProbes int
+
+	// AllowSchemes, AllowHosts, AllowCIDRs and AllowPorts are the allowlists of the backend calls (empty: all)
+	AllowSchemes []string
+	AllowHosts   []string
+	AllowCIDRs   []string
+	AllowPorts   []int
+	// DenyHosts, DenyCIDRs and DenyPorts are the denylists of the backend calls, see targetPolicy
+	DenyHosts []string
+	DenyCIDRs []string
+	DenyPorts []int
 }
 
 func (c *FrontendConfig) SetListenAddr(addr string) {
@@ -36,10 +82,6 @@ func (c *FrontendConfig) SetInstance(instance string) {
 	c.Instance = instance
 }
 
-func (c *FrontendConfig) SetJaegerURL(url string) {
-	c.JaegerURL = url
-}
-
 func (c *FrontendConfig) SetCommand(command string) {
 	c.Command = command
 }
@@ -53,6 +95,10 @@ type Frontend struct {
 	serverRunner model.ServerRunner
 	log          logr.Logger
 	shutdown     <-chan struct{}
+	httpClient   *http.Client
+	tracer       trace.Tracer
+	breakers     *circuitBreakers
+	targetPolicy *targetPolicy
 }
 
 func NewFrontendService(ctx context.Context, cfg interface{}, log logr.Logger) model.Service {
@@ -79,13 +125,58 @@ func (s *Frontend) Run(args []string) error {
 		s.config.Instance, _ = os.Hostname() //nolint:errcheck // not important
 	}
 	s.log.WithValues("config", s.config).Info("Frontend start")
+	s.breakers = newCircuitBreakers(s.config.BreakerFailures, s.config.BreakerOpenTimeout, s.config.BreakerHalfOpenProbes)
+	targetPolicy, err := newTargetPolicy(&s.config)
+	if err != nil {
+		return err
+	}
+	s.targetPolicy = targetPolicy
 
-	traceExporter, err := tracing.JaegerProvider(s.config.JaegerURL)
+	traceExporter, err := tracing.NewExporter(context.Background(), s.config.Config)
+	if err != nil {
+		return err
+	}
+	sampler, err := tracing.NewSampler(s.config.Sampler, s.config.SamplerRules)
+	if err != nil {
+		return err
+	}
+	propagator, err := tracing.NewPropagator(s.config.Propagators)
+	if err != nil {
+		return err
+	}
+	tracerOptions, err := s.config.TracerOptions(s.log)
 	if err != nil {
 		return err
 	}
-	tp := tracing.InitTracer(traceExporter, sdktrace.AlwaysSample(),
-		"frontend.opentracing-example", s.config.Instance, "", s.log,
+	tracerOptions = append(tracerOptions, tracing.WithPropagator(propagator))
+	mp, metricsRegistry, err := tracing.InitMeter(FrontendServiceName, s.config.Instance)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := mp.Shutdown(context.Background()); err != nil {
+			s.log.Error(err, "Error shutting down meter provider")
+		}
+	}()
+	meter := mp.Meter("github.com/pgillich/opentracing-example/frontend")
+	httpMetrics, err := tracing.NewHTTPMetrics(meter, metricsRegistry)
+	if err != nil {
+		return err
+	}
+	if s.config.SpanMetrics {
+		spanMetrics, err := tracing.NewSpanMetricsProcessor(meter) //nolint:govet // err shadow
+		if err != nil {
+			return err
+		}
+		tracerOptions = append(tracerOptions, tracing.WithSpanProcessor(spanMetrics))
+	}
+	var spanStore *tracing.SpanStore
+	if s.config.SpanStoreSize > 0 {
+		spanStore = tracing.NewSpanStore(s.config.SpanStoreSize)
+		tracerOptions = append(tracerOptions, tracing.WithSpanProcessor(spanStore))
+	}
+	tp := tracing.InitTracer(traceExporter, sampler,
+		FrontendServiceName, s.config.Instance, "", s.log, tracerOptions...,
 	)
 	defer func() {
 		if err := tp.Shutdown(context.Background()); err != nil {
@@ -96,54 +187,114 @@ func (s *Frontend) Run(args []string) error {
 		"github.com/pgillich/opentracing-example/frontend",
 		trace.WithInstrumentationVersion(tracing.SemVersion()),
 	)
+	s.tracer = tr
+	s.httpClient = &http.Client{
+		Transport: otelhttp.NewTransport(
+			tracing.ChildSpanTransport(httpMetrics.Transport(s.targetPolicy.transport())),
+			otelhttp.WithPropagators(propagator),
+			otelhttp.WithSpanOptions(trace.WithAttributes(
+				attribute.String(tracing.SpanKeyComponent, tracing.SpanKeyComponentValue),
+			)),
+		),
+		CheckRedirect: s.targetPolicy.checkRedirect,
+	}
 
 	// CHI
 
 	r := chi.NewRouter()
 	r.Use(chi_middleware.RequestLogger(&logger.ChiLogr{Logger: s.log}))
 	r.Use(chi_middleware.Recoverer)
-	r.Use(tracing.ChiTracerMiddleware(tr, s.config.Instance, s.log))
+	r.Handle(tracing.MetricsPath, tracing.MetricsHandler(metricsRegistry, s.log))
+	if s.config.AdminEndpoints {
+		r.Handle(logger.AdminLogLevelPath, logger.LevelHandler())
+		r.Handle(AdminBreakersPath, s.breakers.Handler())
+	}
+	if spanStore != nil {
+		r.Mount("/debug/traces", spanStore.Handler())
+	}
 
-	r.Get("/proxy", func(w http.ResponseWriter, r *http.Request) {
-		if r.Body == nil {
-			s.writeErr(w, http.StatusInternalServerError, errors.New("empty response"))
+	r.Group(func(r chi.Router) {
+		r.Use(tracing.ChiTracerMiddleware(tr, propagator, FrontendServiceName, s.config.Instance, s.log))
+		r.Use(httpMetrics.Middleware)
+		r.Get("/proxy", func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			span := trace.SpanFromContext(ctx)
+			log := logger.FromContext(ctx, s.log)
+			defer func() {
+				spanText, _ := span.SpanContext().MarshalJSON() //nolint:errcheck // not important
+				log.WithValues(
+					"service", "frontend",
+					"span", string(spanText),
+				).V(1).Info("Span END")
+				span.End()
+			}()
 
-			return
-		}
-		defer r.Body.Close() //nolint:errcheck // not important
-		body, err := io.ReadAll(r.Body)
-		if err != nil {
-			s.writeErr(w, http.StatusInternalServerError, err)
+			if r.Body == nil {
+				s.writeErr(w, r, http.StatusInternalServerError, errors.New("empty response"))
 
-			return
-		}
+				return
+			}
+			defer r.Body.Close() //nolint:errcheck // not important
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				s.writeErr(w, r, http.StatusInternalServerError, err)
+
+				return
+			}
 
-		ctx := r.Context()
-		span := trace.SpanFromContext(ctx)
-		defer func() {
-			spanText, _ := span.SpanContext().MarshalJSON() //nolint:errcheck // not important
-			s.log.WithValues(
-				"service", "frontend",
-				"span", string(spanText),
-			).Info("Span END")
-			span.End()
-			tp.ForceFlush(context.Background()) //nolint:errcheck,gosec // not important
-		}()
+			calls := urlCalls(strings.Split(string(body), " "))
+			if rejected := s.rejectTargets(ctx, calls); len(rejected) > 0 {
+				s.writeRejected(w, r, rejected)
 
-		bodies := []string{}
-		for _, beURL := range strings.Split(string(body), " ") {
-			body, err := s.sendToBackend(ctx, beURL) //nolint:govet // err shadow
+				return
+			}
+			results := s.fanOut(ctx, calls)
+			if rejected := resultRejections(calls, results); len(rejected) > 0 {
+				s.writeRejected(w, r, rejected)
+
+				return
+			}
+			bodies, err := combineResults(results)
 			if err != nil {
-				s.writeErr(w, http.StatusInternalServerError, err)
+				s.writePartial(w, r, bodies, err)
 
 				return
 			}
-			bodies = append(bodies, body)
-		}
 
-		if _, err = w.Write([]byte(strings.Join(bodies, " "))); err != nil {
-			s.log.Error(err, "unable to write response")
-		}
+			if _, err = w.Write([]byte(strings.Join(bodies, " "))); err != nil {
+				log.Error(err, "unable to write response")
+			}
+		})
+		r.Post("/proxy", func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			span := trace.SpanFromContext(ctx)
+			defer span.End()
+
+			request, err := s.readProxyRequest(w, r)
+			if errors.Is(err, ErrProxyRequestLarge) {
+				s.writeProxyError(w, r, http.StatusRequestEntityTooLarge, err)
+
+				return
+			} else if err != nil {
+				s.writeProxyError(w, r, http.StatusBadRequest, err)
+
+				return
+			}
+			if err := request.Validate(); err != nil {
+				s.writeProxyError(w, r, http.StatusBadRequest, err)
+
+				return
+			}
+
+			if rejected := s.rejectTargets(ctx, request.Calls); len(rejected) > 0 {
+				response := model.ProxyResponse{Version: model.ProxyAPIVersion, Rejected: rejected}
+				s.writeProxyResponse(w, r, response, errors.WithDetails(ErrTargetDenied, "targets", len(rejected)))
+
+				return
+			}
+			results := s.fanOut(ctx, request.Calls)
+			s.writeProxyResponse(w, r, proxyResponse(request.Calls, results), errors.Combine(resultErrors(results)...))
+		})
 	})
 	h = r
 
@@ -153,34 +304,48 @@ func (s *Frontend) Run(args []string) error {
 	return nil
 }
 
-func (s *Frontend) sendToBackend(ctx context.Context, beURL string) (string, error) {
-	req, err := http.NewRequestWithContext(
-		ctx, http.MethodGet, beURL, http.NoBody,
-	)
+/*
+sendToBackend returns the status code and the body of the response, the body is returned on error status, too.
+If the call has nested calls, they are sent to the next frontend as a JSON request.
+*/
+func (s *Frontend) sendToBackend(ctx context.Context, call model.ProxyCall) (int, string, error) {
+	var reqBody io.Reader = http.NoBody
+	if len(call.Calls) > 0 {
+		nextRequest, err := json.Marshal(model.ProxyRequest{Version: model.ProxyAPIVersion, Calls: call.Calls})
+		if err != nil {
+			return 0, "", errors.Wrap(err, "unable to encode next proxy request")
+		}
+		reqBody = bytes.NewReader(nextRequest)
+	}
+	req, err := http.NewRequestWithContext(ctx, callMethod(call), call.Target, reqBody)
 	if err != nil {
-		return "", errors.Wrap(err, "unable to send request")
+		return 0, "", errors.Wrap(err, "unable to send request")
+	}
+	for name, value := range call.Headers {
+		req.Header.Set(name, value)
 	}
-	httpClient := &http.Client{Transport: otelhttp.NewTransport(
-		http.DefaultTransport,
-		otelhttp.WithPropagators(otel.GetTextMapPropagator()),
-		otelhttp.WithSpanOptions(trace.WithAttributes(
-			attribute.String(tracing.SpanKeyComponent, tracing.SpanKeyComponentValue),
-		)),
-	)}
-	resp, err := httpClient.Do(req)
+	if len(call.Calls) > 0 {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := s.httpClient.Do(req)
 	if err != nil {
-		return "", errors.Wrap(err, "unable to send request")
+		return 0, "", errors.Wrap(err, "unable to send request")
 	}
 	if resp.Body == nil {
-		return "", errors.New("empty body")
+		return resp.StatusCode, "", errors.New("empty body")
 	}
 	beBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", errors.Wrap(err, "unable to read response")
+		return resp.StatusCode, "", errors.Wrap(err, "unable to read response")
 	}
 	resp.Body.Close() //nolint:errcheck,gosec // not important
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return resp.StatusCode, string(beBody), errors.WithDetails(ErrBackendResponse,
+			"url", call.Target, "status", resp.StatusCode, "body", string(beBody),
+		)
+	}
 
-	return string(beBody), nil
+	return resp.StatusCode, string(beBody), nil
 }
 
 /*
@@ -0,0 +1,138 @@
+package logger
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const AdminLogLevelPath = "/admin/loglevel"
+
+var ErrUnknownLogger = errors.NewPlain("unknown logger")
+
+/*
+LevelRequest is the PUT body of the AdminLogLevelPath endpoint, for example:
+
+	{"name": "backend", "level": "trace", "revertAfter": "10m"}
+
+All loggers are changed, if Name is empty. The level is reverted to the configured level after RevertAfter,
+if it's set (Go duration format).
+*/
+type LevelRequest struct {
+	Name        string `json:"name,omitempty"`
+	Level       string `json:"level"`
+	RevertAfter string `json:"revertAfter,omitempty"`
+}
+
+// LevelResponse is the response of the AdminLogLevelPath endpoint: the current levels by logger name
+type LevelResponse struct {
+	Levels map[string]string `json:"levels"`
+}
+
+// GetLevels returns the current levels of the loggers by name
+func GetLevels() map[string]string {
+	loggersMu.Lock()
+	defer loggersMu.Unlock()
+
+	levels := make(map[string]string, len(loggers))
+	for name, logger := range loggers {
+		levels[name] = logger.logrus.GetLevel().String()
+	}
+
+	return levels
+}
+
+/*
+SetLevel changes the level of the named logger (or all loggers, if the name is empty) at runtime.
+If revertAfter is greater than 0, the configured level is set back after revertAfter.
+*/
+func SetLevel(name string, levelText string, revertAfter time.Duration) error {
+	level, err := parseLevel(levelText)
+	if err != nil {
+		return err
+	}
+
+	loggersMu.Lock()
+	defer loggersMu.Unlock()
+
+	names := []string{name}
+	if name == "" {
+		names = make([]string, 0, len(loggers))
+		for loggerName := range loggers {
+			names = append(names, loggerName)
+		}
+		sort.Strings(names)
+	} else if _, has := loggers[name]; !has {
+		return errors.WithDetails(ErrUnknownLogger, "name", name)
+	}
+
+	for _, loggerName := range names {
+		logger := loggers[loggerName]
+		logger.stopRevert()
+		logger.logrus.SetLevel(level)
+		if revertAfter > 0 {
+			logger.startRevert(config.configuredLevel(loggerName), revertAfter)
+		}
+	}
+
+	return nil
+}
+
+func (l *registeredLogger) startRevert(level logrus.Level, revertAfter time.Duration) {
+	l.revert = time.AfterFunc(revertAfter, func() {
+		l.logrus.SetLevel(level)
+	})
+}
+
+func (l *registeredLogger) stopRevert() {
+	if l.revert != nil {
+		l.revert.Stop()
+		l.revert = nil
+	}
+}
+
+// LevelHandler serves the AdminLogLevelPath endpoint: GET returns the levels, PUT changes a level, see LevelRequest
+func LevelHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			request := LevelRequest{}
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+
+				return
+			}
+			var revertAfter time.Duration
+			if request.RevertAfter != "" {
+				var err error
+				if revertAfter, err = time.ParseDuration(request.RevertAfter); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+
+					return
+				}
+			}
+			if err := SetLevel(request.Name, request.Level, revertAfter); err != nil {
+				status := http.StatusBadRequest
+				if errors.Is(err, ErrUnknownLogger) {
+					status = http.StatusNotFound
+				}
+				http.Error(w, err.Error(), status)
+
+				return
+			}
+		default:
+			w.Header().Set("Allow", http.MethodGet+", "+http.MethodPut)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(LevelResponse{Levels: GetLevels()}) //nolint:errcheck,gosec // not important
+	})
+}
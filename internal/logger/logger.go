@@ -1,27 +1,197 @@
 package logger
 
 import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
 	"emperror.dev/errors"
 	"github.com/bombsimon/logrusr/v3"
 	"github.com/go-logr/logr"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
 )
 
 const (
 	KeyCmd = "command"
+
+	FormatText   = "text"
+	FormatJSON   = "json"
+	FormatLogfmt = "logfmt"
+
+	DefaultLevel  = "info"
+	DefaultFormat = FormatText
 )
 
-var ErrInvalidConfig = errors.NewPlain("invalid config")
+var (
+	ErrInvalidConfig    = errors.NewPlain("invalid config")
+	ErrInvalidLogFormat = errors.NewPlain("invalid log format")
+	ErrInvalidLogLevel  = errors.NewPlain("invalid log level")
+)
+
+/*
+Config is the logging config. The debug level enables the V(1), the trace level enables the V(2) logs.
+The Levels are name=level overrides by the name of GetLogger.
+If SpanEvents is set or Exporter is not nil, the records are forwarded, see OtelSink.
+*/
+type Config struct {
+	Level  string
+	Format string
+	Levels []string
+
+	SpanEvents bool
+	Exporter   RecordExporter
+}
+
+type loggerConfig struct {
+	level      logrus.Level
+	formatter  logrus.Formatter
+	levels     map[string]logrus.Level
+	spanEvents bool
+	exporter   RecordExporter
+}
+
+// registeredLogger keeps the logrus logger, so the level can be changed at runtime, see SetLevel
+type registeredLogger struct {
+	log    logr.Logger
+	logrus *logrus.Logger
+	revert *time.Timer
+}
+
+var (
+	loggersMu sync.Mutex                       //nolint:gochecknoglobals // simple logging
+	loggers   = map[string]*registeredLogger{} //nolint:gochecknoglobals // simple logging
+	config    = mustNewLoggerConfig(Config{})  //nolint:gochecknoglobals // simple logging
+)
+
+/*
+Configure sets the level and format of the loggers. The already created loggers are not changed,
+the next GetLogger calls create new loggers by the config. The previous exporter is shut down,
+the export error is sent to the OpenTelemetry error handler.
+*/
+func Configure(cfg Config) error {
+	newConfig, err := newLoggerConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	loggersMu.Lock()
+	previousExporter := config.exporter
+	config = newConfig
+	for _, logger := range loggers {
+		logger.stopRevert()
+	}
+	loggers = map[string]*registeredLogger{}
+	loggersMu.Unlock()
+
+	if previousExporter != nil && previousExporter != newConfig.exporter {
+		if err := previousExporter.Shutdown(context.Background()); err != nil { //nolint:govet // err shadow
+			otel.Handle(err)
+		}
+	}
+
+	return nil
+}
+
+// Flush exports the pending log records, if the exporter is set
+func Flush(ctx context.Context) error {
+	loggersMu.Lock()
+	exporter := config.exporter
+	loggersMu.Unlock()
+	if exporter == nil {
+		return nil
+	}
+
+	return exporter.Flush(ctx)
+}
+
+// GetExporter returns the exporter of the log records, or nil
+func GetExporter() RecordExporter {
+	loggersMu.Lock()
+	defer loggersMu.Unlock()
 
-var loggers = map[string]logr.Logger{} // nolint:gochecknoglobals // simple logging
+	return config.exporter
+}
 
 func GetLogger(app string) logr.Logger {
+	loggersMu.Lock()
+	defer loggersMu.Unlock()
 	if logger, has := loggers[app]; has {
-		return logger
+		return logger.log
 	}
 	lr := logrus.New()
-	lr.Level = logrus.TraceLevel
-	loggers[app] = logrusr.New(lr).WithName(app)
+	lr.Level = config.configuredLevel(app)
+	lr.Formatter = config.formatter
+	log := logrusr.New(lr).WithName(app)
+	if config.spanEvents || config.exporter != nil {
+		log = logr.New(newOtelSink(log.GetSink(), app, config.spanEvents, config.exporter))
+	}
+	loggers[app] = &registeredLogger{log: log, logrus: lr}
+
+	return loggers[app].log
+}
+
+// configuredLevel returns the level of the logger by the config
+func (c *loggerConfig) configuredLevel(app string) logrus.Level {
+	if level, has := c.levels[app]; has {
+		return level
+	}
+
+	return c.level
+}
+
+func newLoggerConfig(cfg Config) (*loggerConfig, error) {
+	if cfg.Level == "" {
+		cfg.Level = DefaultLevel
+	}
+	if cfg.Format == "" {
+		cfg.Format = DefaultFormat
+	}
+
+	newConfig := &loggerConfig{levels: map[string]logrus.Level{}, spanEvents: cfg.SpanEvents, exporter: cfg.Exporter}
+	var err error
+	if newConfig.level, err = parseLevel(cfg.Level); err != nil {
+		return nil, err
+	}
+	for _, nameLevel := range cfg.Levels {
+		name, levelText, found := strings.Cut(nameLevel, "=")
+		if !found || name == "" {
+			return nil, errors.WithDetails(ErrInvalidLogLevel, "override", nameLevel)
+		}
+		if newConfig.levels[name], err = parseLevel(levelText); err != nil {
+			return nil, err
+		}
+	}
+
+	switch strings.ToLower(cfg.Format) {
+	case FormatText:
+		newConfig.formatter = &logrus.TextFormatter{}
+	case FormatJSON:
+		newConfig.formatter = &logrus.JSONFormatter{}
+	case FormatLogfmt:
+		newConfig.formatter = &logrus.TextFormatter{DisableColors: true, FullTimestamp: true, QuoteEmptyFields: true}
+	default:
+		return nil, errors.WithDetails(ErrInvalidLogFormat, "format", cfg.Format)
+	}
+
+	return newConfig, nil
+}
+
+func mustNewLoggerConfig(cfg Config) *loggerConfig {
+	newConfig, err := newLoggerConfig(cfg)
+	if err != nil {
+		panic(err)
+	}
+
+	return newConfig
+}
+
+func parseLevel(text string) (logrus.Level, error) {
+	level, err := logrus.ParseLevel(strings.TrimSpace(text))
+	if err != nil {
+		return level, errors.WithDetails(ErrInvalidLogLevel, "level", text)
+	}
 
-	return loggers[app]
+	return level, nil
 }
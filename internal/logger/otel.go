@@ -0,0 +1,234 @@
+package logger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	ExportNone = "none"
+	// ExportSpan forwards the log records as events of the span of the logger, see WithSpan
+	ExportSpan = "span"
+
+	KeySeverity = attribute.Key("log.severity")
+	KeyLogger   = attribute.Key("log.logger")
+	KeyError    = attribute.Key("exception.message")
+
+	SeverityTrace = "TRACE"
+	SeverityDebug = "DEBUG"
+	SeverityInfo  = "INFO"
+	SeverityError = "ERROR"
+)
+
+// Record is a log record, forwarded by OtelSink
+type Record struct {
+	Time        time.Time
+	Logger      string
+	Service     string
+	Severity    string
+	Message     string
+	Err         error
+	Attributes  []attribute.KeyValue
+	SpanContext trace.SpanContext
+}
+
+// RecordExporter exports the log records, for example tracing.LogExporter
+type RecordExporter interface {
+	Export(record Record)
+	Flush(ctx context.Context) error
+	Shutdown(ctx context.Context) error
+}
+
+/*
+OtelSink is a logr.LogSink, which writes the records to the next sink and forwards them
+as span events and/or to the RecordExporter. The span is set by WithSpan.
+The records are forwarded only if the level is enabled by the next sink.
+*/
+type OtelSink struct {
+	next       logr.LogSink
+	service    string
+	name       string
+	values     []interface{}
+	span       trace.Span
+	spanEvents bool
+	exporter   RecordExporter
+}
+
+func newOtelSink(next logr.LogSink, name string, spanEvents bool, exporter RecordExporter) *OtelSink {
+	return &OtelSink{next: next, service: name, name: name, spanEvents: spanEvents, exporter: exporter}
+}
+
+// ServiceOf returns the service of the records of the logger (see Record.Service), empty, if the records are not forwarded
+func ServiceOf(log logr.Logger) string {
+	if sink, is := log.GetSink().(*OtelSink); is {
+		return sink.service
+	}
+
+	return ""
+}
+
+/*
+WithSpan adds the IDs of the span to the logger (see WithSpanContext).
+If the log records are forwarded, the span is the target of the span events and the parent of the exported records.
+*/
+func WithSpan(log logr.Logger, span trace.Span) logr.Logger {
+	log = WithSpanContext(log, span.SpanContext())
+	if sink, is := log.GetSink().(*OtelSink); is {
+		clone := *sink
+		clone.span = span
+
+		return log.WithSink(&clone)
+	}
+
+	return log
+}
+
+func (s *OtelSink) Init(info logr.RuntimeInfo) {
+	info.CallDepth++
+	s.next.Init(info)
+}
+
+func (s *OtelSink) Enabled(level int) bool {
+	return s.next.Enabled(level)
+}
+
+func (s *OtelSink) Info(level int, msg string, keysAndValues ...interface{}) {
+	s.next.Info(level, msg, keysAndValues...)
+	s.forward(severityByLevel(level), msg, nil, keysAndValues)
+}
+
+func (s *OtelSink) Error(err error, msg string, keysAndValues ...interface{}) {
+	s.next.Error(err, msg, keysAndValues...)
+	s.forward(SeverityError, msg, err, keysAndValues)
+}
+
+func (s *OtelSink) WithValues(keysAndValues ...interface{}) logr.LogSink {
+	clone := *s
+	clone.next = s.next.WithValues(keysAndValues...)
+	clone.values = append(append([]interface{}{}, s.values...), keysAndValues...)
+
+	return &clone
+}
+
+func (s *OtelSink) WithName(name string) logr.LogSink {
+	clone := *s
+	clone.next = s.next.WithName(name)
+	clone.name = s.name + "/" + name
+
+	return &clone
+}
+
+func (s *OtelSink) forward(severity string, msg string, err error, keysAndValues []interface{}) {
+	var spanContext trace.SpanContext
+	if s.span != nil {
+		spanContext = s.span.SpanContext()
+	}
+	attrs := KeyValuesToAttributes(append(append([]interface{}{}, s.values...), keysAndValues...)...)
+
+	if s.spanEvents && s.span != nil && s.span.IsRecording() {
+		eventAttrs := append([]attribute.KeyValue{KeySeverity.String(severity), KeyLogger.String(s.name)}, attrs...)
+		if err != nil {
+			eventAttrs = append(eventAttrs, KeyError.String(err.Error()))
+		}
+		s.span.AddEvent(msg, trace.WithAttributes(eventAttrs...))
+	}
+
+	if s.exporter != nil {
+		s.exporter.Export(Record{
+			Time:        time.Now(),
+			Logger:      s.name,
+			Service:     s.service,
+			Severity:    severity,
+			Message:     msg,
+			Err:         err,
+			Attributes:  attrs,
+			SpanContext: spanContext,
+		})
+	}
+}
+
+// severityByLevel maps the logr verbosity to severity: V(0) is info, V(1) is debug, V(2) and above are trace
+func severityByLevel(level int) string {
+	switch {
+	case level <= 0:
+		return SeverityInfo
+	case level == 1:
+		return SeverityDebug
+	default:
+		return SeverityTrace
+	}
+}
+
+/*
+KeyValuesToAttributes converts the logr key-value pairs to attributes.
+The trace and span IDs are skipped, because they are set on the records, the other values are converted by type,
+the unknown types are JSON encoded (or formatted by %+v).
+*/
+func KeyValuesToAttributes(keysAndValues ...interface{}) []attribute.KeyValue {
+	attrs := make([]attribute.KeyValue, 0, len(keysAndValues)/2) //nolint:gomnd // pairs
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		key, is := keysAndValues[i].(string)
+		if !is {
+			key = fmt.Sprint(keysAndValues[i])
+		}
+		switch key {
+		case KeyTraceID, KeySpanID, KeyTraceFlags:
+			continue
+		}
+		attrs = append(attrs, valueToAttribute(attribute.Key(key), keysAndValues[i+1]))
+	}
+
+	return attrs
+}
+
+func valueToAttribute(key attribute.Key, value interface{}) attribute.KeyValue { //nolint:cyclop // type switch
+	switch typed := value.(type) {
+	case string:
+		return key.String(typed)
+	case bool:
+		return key.Bool(typed)
+	case int:
+		return key.Int(typed)
+	case int8:
+		return key.Int64(int64(typed))
+	case int16:
+		return key.Int64(int64(typed))
+	case int32:
+		return key.Int64(int64(typed))
+	case int64:
+		return key.Int64(typed)
+	case uint8:
+		return key.Int64(int64(typed))
+	case uint16:
+		return key.Int64(int64(typed))
+	case uint32:
+		return key.Int64(int64(typed))
+	case float32:
+		return key.Float64(float64(typed))
+	case float64:
+		return key.Float64(typed)
+	case []string:
+		return key.StringSlice(typed)
+	case error:
+		return key.String(typed.Error())
+	case time.Duration:
+		return key.String(typed.String())
+	case time.Time:
+		return key.String(typed.Format(time.RFC3339Nano))
+	case fmt.Stringer:
+		return key.String(typed.String())
+	case nil:
+		return key.String("")
+	}
+	if encoded, err := json.Marshal(value); err == nil {
+		return key.String(string(encoded))
+	}
+
+	return key.String(fmt.Sprintf("%+v", value))
+}
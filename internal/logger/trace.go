@@ -0,0 +1,60 @@
+package logger
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	KeyTraceID    = "trace_id"
+	KeySpanID     = "span_id"
+	KeyTraceFlags = "trace_flags"
+)
+
+// WithSpanContext adds the trace ID, span ID and trace flags to the logger, if the span context is valid
+func WithSpanContext(log logr.Logger, spanContext trace.SpanContext) logr.Logger {
+	if !spanContext.IsValid() {
+		return log
+	}
+
+	return log.WithValues(
+		KeyTraceID, spanContext.TraceID().String(),
+		KeySpanID, spanContext.SpanID().String(),
+		KeyTraceFlags, spanContext.TraceFlags().String(),
+	)
+}
+
+/*
+FromContext returns the request logger of the context, see ContextWithRequestLogger.
+If the context has no logger, the fallback logger is returned with the active span, see WithSpan.
+*/
+func FromContext(ctx context.Context, fallback logr.Logger) logr.Logger {
+	if log, err := logr.FromContext(ctx); err == nil {
+		return log
+	}
+
+	return WithSpan(fallback, trace.SpanFromContext(ctx))
+}
+
+/*
+ContextWithRequestLogger builds the logger of the request from the chi request logger entry (if any)
+or the fallback logger, adds the span (see WithSpan) and stores it in the context, see FromContext.
+The chi log entry of the request gets the span IDs, too.
+*/
+func ContextWithRequestLogger(ctx context.Context, r *http.Request, span trace.Span, fallback logr.Logger) context.Context {
+	log := fallback
+	entry, hasEntry := middleware.GetLogEntry(r).(*ChiLogrEntry)
+	if hasEntry {
+		log = entry.Logger
+	}
+	log = WithSpan(log, span)
+	if hasEntry {
+		entry.Logger = log
+	}
+
+	return logr.NewContext(ctx, log)
+}
@@ -0,0 +1,199 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"emperror.dev/errors"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// ProxyAPIVersion is the version of the JSON contract of the /proxy endpoint
+	ProxyAPIVersion = "v1"
+
+	// MaxCallDepth is the maximum depth of the call tree (1: no nested calls)
+	MaxCallDepth = 5
+	// MaxCalls is the maximum number of the calls in the call tree (the nested calls included)
+	MaxCalls = 100
+)
+
+var ErrProxyRequest = errors.NewPlain("invalid proxy request")
+
+// ProxyRequest is the JSON request of the /proxy endpoint (POST, application/json)
+type ProxyRequest struct {
+	Version string      `json:"version"`
+	Calls   []ProxyCall `json:"calls"`
+}
+
+/*
+ProxyCall is a downstream call. Method is GET, if empty. Timeout overrides the backendTimeout of the frontend.
+If Calls is not empty, the target is the /proxy endpoint of a next frontend, which gets Calls as a JSON request (POST),
+so a request can traverse a call tree, for example frontend→frontendB→[backend1, backend2→backend3].
+*/
+type ProxyCall struct {
+	Target  string            `json:"target"`
+	Method  string            `json:"method,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Timeout Duration          `json:"timeout,omitempty"`
+	Retry   *RetryPolicy      `json:"retry,omitempty"`
+	Calls   []ProxyCall       `json:"calls,omitempty"`
+}
+
+// RetryPolicy overrides the retry flags of the frontend for a call, the zero fields are not overridden
+type RetryPolicy struct {
+	MaxAttempts int      `json:"maxAttempts,omitempty"`
+	Backoff     Duration `json:"backoff,omitempty"`
+	MaxBackoff  Duration `json:"maxBackoff,omitempty"`
+	RetryOn     []int    `json:"retryOn,omitempty"`
+}
+
+/*
+ProxyResponse is the JSON response of the /proxy endpoint, Results are in the order of the calls.
+Rejected has the targets, which were denied by the outbound target policy of the frontend.
+*/
+type ProxyResponse struct {
+	Version  string           `json:"version"`
+	Results  []ProxyResult    `json:"results,omitempty"`
+	Rejected []ProxyRejection `json:"rejected,omitempty"`
+	Error    string           `json:"error,omitempty"`
+}
+
+// ProxyRejection is a target denied by the outbound target policy
+type ProxyRejection struct {
+	Target string `json:"target"`
+	Reason string `json:"reason"`
+}
+
+/*
+ProxyResult is the result of a downstream call. Status is 0, if no response was received.
+The results of the nested calls are in Results (instead of Body), if the next frontend responded by JSON.
+*/
+type ProxyResult struct {
+	Target  string        `json:"target"`
+	Status  int           `json:"status"`
+	Body    string        `json:"body"`
+	Latency Duration      `json:"latency"`
+	Error   string        `json:"error,omitempty"`
+	SpanID  string        `json:"spanID,omitempty"`
+	Results []ProxyResult `json:"results,omitempty"`
+}
+
+/*
+Validate checks the version and the calls. The size of the call tree is limited by MaxCallDepth and MaxCalls,
+because the nested calls are forwarded by the next frontends, so a small request could cause a lot of calls.
+*/
+func (r *ProxyRequest) Validate() error {
+	if r.Version != ProxyAPIVersion {
+		return errors.Wrapf(ErrProxyRequest, "unsupported version %q (supported: %s)", r.Version, ProxyAPIVersion)
+	}
+	if count := countCalls(r.Calls); count > MaxCalls {
+		return errors.Wrapf(ErrProxyRequest, "too many calls: %d (max %d)", count, MaxCalls)
+	}
+
+	return validateCalls(r.Calls, "", 1)
+}
+
+// countCalls returns the number of the calls in the call tree
+func countCalls(calls []ProxyCall) int {
+	count := len(calls)
+	for _, call := range calls {
+		count += countCalls(call.Calls)
+	}
+
+	return count
+}
+
+/*
+validateCalls checks the call tree, path is the position of the calls in the tree, for example "0.1.",
+depth is the depth of the calls (1 at the top)
+*/
+func validateCalls(calls []ProxyCall, path string, depth int) error {
+	if len(calls) == 0 {
+		return errors.Wrapf(ErrProxyRequest, "no calls at %q", path)
+	}
+	if depth > MaxCallDepth {
+		return errors.Wrapf(ErrProxyRequest, "call tree is deeper than %d at %q", MaxCallDepth, path)
+	}
+	for c, call := range calls {
+		if call.Target == "" {
+			return errors.Wrapf(ErrProxyRequest, "empty target of call %s%d", path, c)
+		}
+		if call.Timeout < 0 {
+			return errors.Wrapf(ErrProxyRequest, "negative timeout of call %s%d", path, c)
+		}
+		if call.Retry != nil && (call.Retry.MaxAttempts < 0 || call.Retry.Backoff < 0 || call.Retry.MaxBackoff < 0) {
+			return errors.Wrapf(ErrProxyRequest, "negative retry value of call %s%d", path, c)
+		}
+		if len(call.Calls) > 0 {
+			if call.Method != "" && call.Method != http.MethodPost {
+				return errors.Wrapf(ErrProxyRequest, "method of call %s%d must be POST (has nested calls)", path, c)
+			}
+			if err := validateCalls(call.Calls, fmt.Sprintf("%s%d.", path, c), depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+/*
+ParseProxyScenario parses a scenario file (YAML or JSON) to a proxy request, for example:
+
+	version: v1
+	calls:
+	  - target: http://frontend-b/proxy
+	    calls:
+	      - target: http://backend-1/ping
+	      - target: http://frontend-c/proxy
+	        calls:
+	          - target: http://backend-2/ping
+*/
+func ParseProxyScenario(data []byte) (*ProxyRequest, error) {
+	var scenario interface{}
+	if err := yaml.Unmarshal(data, &scenario); err != nil {
+		return nil, errors.Wrap(err, "unable to parse scenario")
+	}
+	// the YAML is converted to JSON, so the JSON field names and the Duration decoder are used
+	jsonScenario, err := json.Marshal(scenario)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to convert scenario")
+	}
+	request := &ProxyRequest{}
+	if err := json.Unmarshal(jsonScenario, request); err != nil {
+		return nil, errors.Wrap(err, "unable to decode scenario")
+	}
+	if err := request.Validate(); err != nil {
+		return nil, err
+	}
+
+	return request, nil
+}
+
+// Duration is a time.Duration, JSON encoded as a duration string, for example "1.5s"
+type Duration time.Duration
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String()) //nolint:wrapcheck // string
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return errors.Wrap(err, "duration must be a string")
+	}
+	duration, err := time.ParseDuration(text)
+	if err != nil {
+		return errors.Wrap(err, "invalid duration")
+	}
+	*d = Duration(duration)
+
+	return nil
+}
@@ -0,0 +1,224 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/pgillich/opentracing-example/internal/model"
+	"github.com/pgillich/opentracing-example/internal/tracing"
+)
+
+var (
+	ErrProxyTimeout      = errors.NewPlain("proxy timeout")
+	ErrProxyRequestLarge = errors.NewPlain("proxy request too large")
+)
+
+// backendResult is the result of one backend call of the fan-out
+type backendResult struct {
+	status  int
+	body    string
+	err     error
+	latency time.Duration
+	spanID  string
+	// results of the nested calls, see model.ProxyCall
+	results []model.ProxyResult
+}
+
+/*
+fanOut calls the backends concurrently, at most MaxParallel at the same time, so the client spans are parallel siblings.
+Every attempt of a call gets its own timeout or BackendTimeout, all calls together get ProxyTimeout (both derived from the request context).
+The results are in the order of the calls, a failed call does not cancel the others (partial results).
+*/
+func (s *Frontend) fanOut(ctx context.Context, calls []model.ProxyCall) []backendResult {
+	if s.config.ProxyTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.config.ProxyTimeout)
+		defer cancel()
+	}
+	maxParallel := s.config.MaxParallel
+	if maxParallel <= 0 || maxParallel > len(calls) {
+		maxParallel = len(calls)
+	}
+
+	results := make([]backendResult, len(calls))
+	slots := make(chan struct{}, maxParallel)
+	wg := sync.WaitGroup{}
+	for c, call := range calls {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			results[c] = backendResult{err: errors.WrapWithDetails(ErrProxyTimeout, ctx.Err().Error(), "url", call.Target)}
+
+			continue
+		}
+		wg.Add(1)
+		go func(c int, call model.ProxyCall) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			results[c] = s.callBackend(ctx, call)
+		}(c, call)
+	}
+	wg.Wait()
+
+	return results
+}
+
+/*
+callBackend calls the backend once, or by the retry policy, if more attempts are allowed, see retryBackend.
+The call is short-circuited, if the circuit breaker of the backend host is open, see circuitBreakers.
+The result of the call (after all attempts) is recorded once by the circuit breaker.
+*/
+func (s *Frontend) callBackend(ctx context.Context, call model.ProxyCall) backendResult {
+	host := backendHost(call.Target)
+	allowed, probe, state, transition := s.breakers.allow(host)
+	s.logTransition(ctx, transition)
+	if !allowed {
+		return s.shortCircuit(ctx, call, host, state)
+	}
+
+	var result backendResult
+	if policy := s.retryPolicy(call); policy.maxAttempts > 1 {
+		result = s.retryBackend(ctx, call, policy)
+	} else {
+		result = s.attemptBackend(ctx, call, 0)
+	}
+	s.logTransition(ctx, s.breakers.record(host, probe, !isBreakerFailure(ctx, call, result)))
+
+	return result
+}
+
+// attemptBackend calls the backend with the timeout of the call (or BackendTimeout), resendCount is 0 at the first attempt
+func (s *Frontend) attemptBackend(ctx context.Context, call model.ProxyCall, resendCount int) backendResult {
+	parentCtx := ctx
+
+	timeout := s.config.BackendTimeout
+	if call.Timeout > 0 {
+		timeout = time.Duration(call.Timeout)
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	ctx, childSpan := tracing.ContextWithChildSpan(tracing.ContextWithResendCount(ctx, resendCount))
+	start := time.Now()
+	status, body, err := s.sendToBackend(ctx, call)
+	result := backendResult{status: status, body: body, err: err, latency: time.Since(start)}
+	if childSpan.IsValid() {
+		result.spanID = childSpan.SpanID().String()
+	}
+	if len(call.Calls) > 0 {
+		next := model.ProxyResponse{}
+		if json.Unmarshal([]byte(body), &next) == nil && next.Version != "" {
+			result.body = ""
+			result.results = next.Results
+		}
+	}
+	if errors.Is(err, ErrTargetDenied) {
+		recordRejection(parentCtx, call.Target, err)
+	}
+
+	return result
+}
+
+// resultErrors returns the errors of the failed calls
+func resultErrors(results []backendResult) []error {
+	errs := []error{}
+	for _, result := range results {
+		if result.err != nil {
+			errs = append(errs, result.err)
+		}
+	}
+
+	return errs
+}
+
+/*
+readProxyRequest reads the JSON proxy request, the body is limited by MaxRequestBody (see http.MaxBytesReader).
+Returns ErrProxyRequestLarge, if the body is larger.
+*/
+func (s *Frontend) readProxyRequest(w http.ResponseWriter, r *http.Request) (*model.ProxyRequest, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.config.MaxRequestBody))
+	if err != nil {
+		if int64(len(body)) >= s.config.MaxRequestBody {
+			return nil, errors.WithDetails(ErrProxyRequestLarge, "limit", s.config.MaxRequestBody)
+		}
+
+		return nil, errors.Wrap(err, "unable to read proxy request")
+	}
+	request := &model.ProxyRequest{}
+	if err := json.Unmarshal(body, request); err != nil {
+		return nil, errors.Wrap(err, "unable to decode proxy request")
+	}
+
+	return request, nil
+}
+
+// callMethod returns the HTTP method of the call: POST for the nested calls, GET by default
+func callMethod(call model.ProxyCall) string {
+	if len(call.Calls) > 0 {
+		return http.MethodPost
+	}
+	if call.Method == "" {
+		return http.MethodGet
+	}
+
+	return call.Method
+}
+
+// urlCalls converts the URLs of the legacy text request to GET calls
+func urlCalls(beURLs []string) []model.ProxyCall {
+	calls := make([]model.ProxyCall, 0, len(beURLs))
+	for _, beURL := range beURLs {
+		calls = append(calls, model.ProxyCall{Target: beURL})
+	}
+
+	return calls
+}
+
+// proxyResponse converts the results to the JSON response, see model.ProxyResponse
+func proxyResponse(calls []model.ProxyCall, results []backendResult) model.ProxyResponse {
+	response := model.ProxyResponse{Version: model.ProxyAPIVersion, Results: make([]model.ProxyResult, 0, len(results))}
+	for r, result := range results {
+		proxyResult := model.ProxyResult{
+			Target:  calls[r].Target,
+			Status:  result.status,
+			Body:    result.body,
+			Latency: model.Duration(result.latency),
+			SpanID:  result.spanID,
+			Results: result.results,
+		}
+		if result.err != nil {
+			proxyResult.Error = result.err.Error()
+		}
+		response.Results = append(response.Results, proxyResult)
+	}
+	response.Rejected = resultRejections(calls, results)
+
+	return response
+}
+
+/*
+combineResults returns the bodies of the calls (empty for the failed calls, so the positions are kept)
+and the combined error of the failed calls, the errors have the position of the call
+*/
+func combineResults(results []backendResult) ([]string, error) {
+	bodies := make([]string, len(results))
+	errs := []error{}
+	for r, result := range results {
+		if result.err != nil {
+			errs = append(errs, errors.Wrapf(result.err, "call %d", r))
+		} else {
+			bodies[r] = result.body
+		}
+	}
+
+	return bodies, errors.Combine(errs...)
+}
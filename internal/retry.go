@@ -0,0 +1,202 @@
+package internal
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/pgillich/opentracing-example/internal/model"
+	"github.com/pgillich/opentracing-example/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	SpanKeyRetryAttempts = attribute.Key("retry.attempts")
+	SpanKeyRetryDelay    = attribute.Key("retry.delay")
+	SpanKeyRetryReason   = attribute.Key("retry.reason")
+
+	// HeaderIdempotencyKey marks a non-idempotent request as retryable
+	HeaderIdempotencyKey = "Idempotency-Key"
+
+	// MaxRetryAttempts limits the maxAttempts of a call (or RetryMaxAttempts, if it is more)
+	MaxRetryAttempts = 10
+	// maxRetryBackoff limits the doubling of the backoff, if RetryMaxBackoff is 0
+	maxRetryBackoff = time.Minute
+)
+
+// retryPolicy is the retry policy of a backend call, see Frontend.retryPolicy
+type retryPolicy struct {
+	maxAttempts   int
+	backoff       time.Duration
+	maxBackoff    time.Duration
+	retryOn       map[int]bool
+	networkErrors bool
+	nonIdempotent bool
+}
+
+// retryPolicy builds the retry policy of the call from the flags and the retry field of the call
+func (s *Frontend) retryPolicy(call model.ProxyCall) retryPolicy {
+	policy := retryPolicy{
+		maxAttempts:   s.config.RetryMaxAttempts,
+		backoff:       s.config.RetryBackoff,
+		maxBackoff:    s.config.RetryMaxBackoff,
+		networkErrors: s.config.RetryNetworkErrors,
+		nonIdempotent: s.config.RetryNonIdempotent,
+	}
+	retryOn := s.config.RetryOn
+	if call.Retry != nil {
+		if call.Retry.MaxAttempts > 0 {
+			policy.maxAttempts = call.Retry.MaxAttempts
+			limit := MaxRetryAttempts
+			if s.config.RetryMaxAttempts > limit {
+				limit = s.config.RetryMaxAttempts
+			}
+			if policy.maxAttempts > limit {
+				policy.maxAttempts = limit
+			}
+		}
+		if call.Retry.Backoff > 0 {
+			policy.backoff = time.Duration(call.Retry.Backoff)
+		}
+		if call.Retry.MaxBackoff > 0 {
+			policy.maxBackoff = time.Duration(call.Retry.MaxBackoff)
+		}
+		if len(call.Retry.RetryOn) > 0 {
+			retryOn = call.Retry.RetryOn
+		}
+	}
+	policy.retryOn = make(map[int]bool, len(retryOn))
+	for _, status := range retryOn {
+		policy.retryOn[status] = true
+	}
+
+	return policy
+}
+
+/*
+retryReason returns the reason of the retry, or empty string, if the result is final:
+the call succeeded, the status is not retryable, the method is not idempotent (without Idempotency-Key header),
+the target was denied or the parent context is done.
+*/
+func (p retryPolicy) retryReason(ctx context.Context, call model.ProxyCall, result backendResult) string {
+	if result.err == nil || ctx.Err() != nil || errors.Is(result.err, ErrTargetDenied) {
+		return ""
+	}
+	if !p.nonIdempotent && !isIdempotent(call) {
+		return ""
+	}
+	if result.status == 0 {
+		if p.networkErrors {
+			return "network error"
+		}
+
+		return ""
+	}
+	if p.retryOn[result.status] {
+		return "status " + strconv.Itoa(result.status)
+	}
+
+	return ""
+}
+
+/*
+delay returns the exponential backoff before the next attempt, with equal jitter (half of the backoff is random).
+The backoff is limited by maxBackoff (or maxRetryBackoff, if it is 0), so the doubling cannot overflow.
+*/
+func (p retryPolicy) delay(attempt int) time.Duration {
+	maxBackoff := p.maxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = maxRetryBackoff
+	}
+	backoff := p.backoff
+	for a := 1; a < attempt && backoff < maxBackoff; a++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	if backoff <= 0 {
+		return 0
+	}
+	half := backoff / 2 //nolint:gomnd // half
+
+	return half + time.Duration(rand.Int63n(int64(backoff-half)+1)) //nolint:gosec // jitter
+}
+
+// isIdempotent returns true for the idempotent methods (RFC 9110) and for the requests with Idempotency-Key header
+func isIdempotent(call model.ProxyCall) bool {
+	switch callMethod(call) {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	for name := range call.Headers {
+		if http.CanonicalHeaderKey(name) == HeaderIdempotencyKey {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+retryBackend calls the backend by the retry policy. Every attempt is a client span (with http.resend_count),
+the parent span has the final outcome and a retry event before each resend. The result has the ID of the parent span.
+*/
+func (s *Frontend) retryBackend(ctx context.Context, call model.ProxyCall, policy retryPolicy) backendResult {
+	method := callMethod(call)
+	ctx, span := s.tracer.Start(ctx, "Retry "+method,
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(semconv.HTTPMethodKey.String(method), semconv.HTTPURLKey.String(call.Target)),
+	)
+	defer span.End()
+
+	start := time.Now()
+	var result backendResult
+	attempt := 0
+	for {
+		result = s.attemptBackend(ctx, call, attempt)
+		attempt++
+		reason := policy.retryReason(ctx, call, result)
+		if reason == "" || attempt >= policy.maxAttempts {
+			break
+		}
+		delay := policy.delay(attempt)
+		span.AddEvent("retry", trace.WithAttributes(
+			SpanKeyRetryReason.String(reason),
+			SpanKeyRetryDelay.String(delay.String()),
+			tracing.SpanKeyResendCount.Int(attempt),
+		))
+		if !sleepContext(ctx, delay) {
+			break
+		}
+	}
+
+	span.SetAttributes(SpanKeyRetryAttempts.Int(attempt))
+	if result.status != 0 {
+		span.SetAttributes(semconv.HTTPStatusCodeKey.Int(result.status))
+	}
+	if result.err != nil {
+		tracing.RecordError(span, result.err)
+	}
+	result.latency = time.Since(start)
+	result.spanID = span.SpanContext().SpanID().String()
+
+	return result
+}
+
+// sleepContext waits for the delay, returns false, if the context is done earlier
+func sleepContext(ctx context.Context, delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
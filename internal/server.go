@@ -2,10 +2,16 @@ package internal
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
+	"strings"
 
 	"emperror.dev/errors"
 	"github.com/go-logr/logr"
+	"github.com/pgillich/opentracing-example/internal/logger"
+	"github.com/pgillich/opentracing-example/internal/model"
+	"github.com/pgillich/opentracing-example/internal/tracing"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type ConfigSetter interface {
@@ -16,7 +22,10 @@ type ConfigSetter interface {
 	GetOptions() []string
 }
 
-var ErrInvalidServerRunner = errors.NewPlain("invalid server runner")
+var (
+	ErrInvalidServerRunner = errors.NewPlain("invalid server runner")
+	ErrBackendResponse     = errors.NewPlain("backend response error")
+)
 
 func RunServer(h http.Handler, shutdown <-chan struct{}, addr string, log logr.Logger) {
 	server := &http.Server{ // nolint:gosec // not secure
@@ -38,9 +47,71 @@ func RunServer(h http.Handler, shutdown <-chan struct{}, addr string, log logr.L
 	}
 }
 
-func (s *Frontend) writeErr(w http.ResponseWriter, statusCode int, err error) {
+// writeErr writes the error response and records the error on the server span
+func (s *Frontend) writeErr(w http.ResponseWriter, r *http.Request, statusCode int, err error) {
 	w.WriteHeader(statusCode)
+	tracing.RecordError(trace.SpanFromContext(r.Context()), err)
 	if _, err := w.Write([]byte(err.Error())); err != nil { //nolint:govet // err shadow
-		s.log.Error(err, "unable to write response")
+		logger.FromContext(r.Context(), s.log).Error(err, "unable to write response")
+	}
+}
+
+/*
+writePartial writes the bodies of the backend calls in the first line (see combineResults, a failed call
+has an empty slot) and the error of each failed call in a separate line
+*/
+func (s *Frontend) writePartial(w http.ResponseWriter, r *http.Request, bodies []string, err error) {
+	w.WriteHeader(http.StatusBadGateway)
+	tracing.RecordError(trace.SpanFromContext(r.Context()), err)
+	lines := []string{strings.Join(bodies, " ")}
+	for _, callErr := range errors.GetErrors(err) {
+		lines = append(lines, callErr.Error())
+	}
+	if _, err := w.Write([]byte(strings.Join(lines, "\n"))); err != nil { //nolint:govet // err shadow
+		logger.FromContext(r.Context(), s.log).Error(err, "unable to write response")
+	}
+}
+
+/*
+writeProxyResponse writes the JSON response of /proxy. The status is 200, if all calls succeeded,
+403, if a target was rejected, otherwise 502. The error is recorded on the server span.
+*/
+func (s *Frontend) writeProxyResponse(w http.ResponseWriter, r *http.Request, response model.ProxyResponse, err error) {
+	statusCode := http.StatusOK
+	if err != nil {
+		statusCode = http.StatusBadGateway
+		tracing.RecordError(trace.SpanFromContext(r.Context()), err)
+	}
+	if len(response.Rejected) > 0 {
+		statusCode = http.StatusForbidden
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(response); err != nil { //nolint:govet // err shadow
+		logger.FromContext(r.Context(), s.log).Error(err, "unable to write response")
+	}
+}
+
+// writeRejected writes the rejected targets and the reasons (a line for each target) with 403 status
+func (s *Frontend) writeRejected(w http.ResponseWriter, r *http.Request, rejected []model.ProxyRejection) {
+	w.WriteHeader(http.StatusForbidden)
+	tracing.RecordError(trace.SpanFromContext(r.Context()), errors.WithDetails(ErrTargetDenied, "targets", len(rejected)))
+	lines := make([]string, 0, len(rejected))
+	for _, rejection := range rejected {
+		lines = append(lines, rejection.Target+": "+rejection.Reason)
+	}
+	if _, err := w.Write([]byte(strings.Join(lines, "\n"))); err != nil {
+		logger.FromContext(r.Context(), s.log).Error(err, "unable to write response")
+	}
+}
+
+// writeProxyError writes the JSON error response of /proxy and records the error on the server span
+func (s *Frontend) writeProxyError(w http.ResponseWriter, r *http.Request, statusCode int, err error) {
+	tracing.RecordError(trace.SpanFromContext(r.Context()), err)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	response := model.ProxyResponse{Version: model.ProxyAPIVersion, Error: err.Error()}
+	if err := json.NewEncoder(w).Encode(response); err != nil { //nolint:govet // err shadow
+		logger.FromContext(r.Context(), s.log).Error(err, "unable to write response")
 	}
 }
@@ -0,0 +1,290 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/pgillich/opentracing-example/internal/model"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	SpanKeyTargetURL    = attribute.Key("target.url")
+	SpanKeyTargetReason = attribute.Key("target.reason")
+
+	dialTimeout   = 30 * time.Second
+	dialKeepAlive = 30 * time.Second
+)
+
+var (
+	ErrTargetDenied  = errors.NewPlain("outbound target denied")
+	ErrInvalidPolicy = errors.NewPlain("invalid outbound target policy")
+)
+
+/*
+targetPolicy is the allowlist and denylist of the outbound targets, so /proxy is not an open SSRF relay.
+The scheme, host and port of the URL are checked before dialing (and the address, if the host is an IP),
+the resolved address is re-checked by the dialer (Control), so a host name cannot point to a denied address.
+An empty allowlist allows all, the denylist has priority.
+*/
+type targetPolicy struct {
+	allowSchemes map[string]bool
+	allowHosts   []string
+	denyHosts    []string
+	allowNets    []*net.IPNet
+	denyNets     []*net.IPNet
+	allowPorts   map[int]bool
+	denyPorts    map[int]bool
+}
+
+func newTargetPolicy(config *FrontendConfig) (*targetPolicy, error) {
+	policy := &targetPolicy{
+		allowSchemes: map[string]bool{},
+		allowHosts:   normalizeHosts(config.AllowHosts),
+		denyHosts:    normalizeHosts(config.DenyHosts),
+		allowPorts:   intSet(config.AllowPorts),
+		denyPorts:    intSet(config.DenyPorts),
+	}
+	for _, scheme := range config.AllowSchemes {
+		policy.allowSchemes[strings.ToLower(scheme)] = true
+	}
+	var err error
+	if policy.allowNets, err = parseCIDRs(config.AllowCIDRs); err != nil {
+		return nil, err
+	}
+	if policy.denyNets, err = parseCIDRs(config.DenyCIDRs); err != nil {
+		return nil, err
+	}
+
+	return policy, nil
+}
+
+// check returns ErrTargetDenied with the reason, if the target is not allowed
+func (p *targetPolicy) check(target string) error {
+	u, err := url.Parse(target)
+	if err != nil {
+		return errors.Wrap(ErrTargetDenied, "invalid URL")
+	}
+
+	return p.checkURL(u)
+}
+
+func (p *targetPolicy) checkURL(u *url.URL) error {
+	scheme := strings.ToLower(u.Scheme)
+	if len(p.allowSchemes) > 0 && !p.allowSchemes[scheme] {
+		return errors.Wrap(ErrTargetDenied, fmt.Sprintf("scheme %q is not allowed", scheme))
+	}
+	host := normalizeHost(u.Hostname())
+	if host == "" {
+		return errors.Wrap(ErrTargetDenied, "empty host")
+	}
+	if matchHost(p.denyHosts, host) {
+		return errors.Wrap(ErrTargetDenied, fmt.Sprintf("host %q is denied", host))
+	}
+	if len(p.allowHosts) > 0 && !matchHost(p.allowHosts, host) {
+		return errors.Wrap(ErrTargetDenied, fmt.Sprintf("host %q is not allowed", host))
+	}
+	port, err := urlPort(u)
+	if err != nil {
+		return errors.Wrap(ErrTargetDenied, "invalid port")
+	}
+	if err = p.checkPort(port); err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return p.checkIP(ip)
+	}
+
+	return nil
+}
+
+func (p *targetPolicy) checkPort(port int) error {
+	if p.denyPorts[port] {
+		return errors.Wrap(ErrTargetDenied, fmt.Sprintf("port %d is denied", port))
+	}
+	if len(p.allowPorts) > 0 && !p.allowPorts[port] {
+		return errors.Wrap(ErrTargetDenied, fmt.Sprintf("port %d is not allowed", port))
+	}
+
+	return nil
+}
+
+func (p *targetPolicy) checkIP(ip net.IP) error {
+	for _, ipNet := range p.denyNets {
+		if ipNet.Contains(ip) {
+			return errors.Wrap(ErrTargetDenied, fmt.Sprintf("address %s is denied (%s)", ip, ipNet))
+		}
+	}
+	if len(p.allowNets) == 0 {
+		return nil
+	}
+	for _, ipNet := range p.allowNets {
+		if ipNet.Contains(ip) {
+			return nil
+		}
+	}
+
+	return errors.Wrap(ErrTargetDenied, fmt.Sprintf("address %s is not allowed", ip))
+}
+
+// control re-checks the resolved address before connecting, see net.Dialer.Control
+func (p *targetPolicy) control(network string, address string, _ syscall.RawConn) error {
+	host, portText, err := net.SplitHostPort(address)
+	if err != nil {
+		return errors.Wrap(ErrTargetDenied, "invalid address")
+	}
+	port, err := strconv.Atoi(portText)
+	if err != nil {
+		return errors.Wrap(ErrTargetDenied, "invalid port")
+	}
+	if err = p.checkPort(port); err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return errors.Wrap(ErrTargetDenied, fmt.Sprintf("unresolved address %s (%s)", host, network))
+	}
+
+	return p.checkIP(ip)
+}
+
+/*
+transport returns a clone of http.DefaultTransport, which dials by the policy.
+The proxy of the environment (HTTP_PROXY) is not used, because the dialer would check the address of the proxy only.
+*/
+func (p *targetPolicy) transport() http.RoundTripper {
+	transport := http.DefaultTransport.(*http.Transport).Clone() //nolint:forcetypeassert // standard library
+	transport.Proxy = nil
+	transport.DialContext = (&net.Dialer{
+		Timeout:   dialTimeout,
+		KeepAlive: dialKeepAlive,
+		Control:   p.control,
+	}).DialContext
+
+	return transport
+}
+
+// checkRedirect checks the redirect target by the policy, see http.Client.CheckRedirect
+func (p *targetPolicy) checkRedirect(req *http.Request, via []*http.Request) error {
+	const maxRedirects = 10
+	if len(via) >= maxRedirects {
+		return errors.New("stopped after 10 redirects")
+	}
+
+	return p.checkURL(req.URL)
+}
+
+/*
+rejectTargets checks the targets of the call tree before dialing, the rejected targets are recorded
+as span events on the active span. The nested calls are checked, too (not only by the next frontend),
+because the next frontend may not have the same policy.
+*/
+func (s *Frontend) rejectTargets(ctx context.Context, calls []model.ProxyCall) []model.ProxyRejection {
+	rejected := []model.ProxyRejection{}
+	for _, call := range calls {
+		if err := s.targetPolicy.check(call.Target); err != nil {
+			rejected = append(rejected, model.ProxyRejection{Target: call.Target, Reason: err.Error()})
+			recordRejection(ctx, call.Target, err)
+		}
+		rejected = append(rejected, s.rejectTargets(ctx, call.Calls)...)
+	}
+
+	return rejected
+}
+
+// recordRejection adds the rejected target to the active span as a span event
+func recordRejection(ctx context.Context, target string, err error) {
+	trace.SpanFromContext(ctx).AddEvent("target rejected", trace.WithAttributes(
+		SpanKeyTargetURL.String(target),
+		SpanKeyTargetReason.String(err.Error()),
+	))
+}
+
+// resultRejections returns the targets, which were rejected by the dialer (after DNS resolution)
+func resultRejections(calls []model.ProxyCall, results []backendResult) []model.ProxyRejection {
+	rejected := []model.ProxyRejection{}
+	for r, result := range results {
+		if errors.Is(result.err, ErrTargetDenied) {
+			rejected = append(rejected, model.ProxyRejection{Target: calls[r].Target, Reason: result.err.Error()})
+		}
+	}
+
+	return rejected
+}
+
+// matchHost matches the host to the patterns, "*.example.com" matches the subdomains of example.com
+func matchHost(patterns []string, host string) bool {
+	for _, pattern := range patterns {
+		if pattern == host || (strings.HasPrefix(pattern, "*.") && strings.HasSuffix(host, pattern[1:])) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// urlPort returns the port of the URL, or the default port of the scheme
+func urlPort(u *url.URL) (int, error) {
+	if port := u.Port(); port != "" {
+		return strconv.Atoi(port) //nolint:wrapcheck // wrapped by the caller
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "https":
+		return 443, nil //nolint:gomnd // default port
+	default:
+		return 80, nil //nolint:gomnd // default port
+	}
+}
+
+// parseCIDRs parses the CIDRs, a single IP address is a /32 (or /128) network
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	ipNets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, errors.WrapWithDetails(ErrInvalidPolicy, err.Error(), "cidr", cidr)
+		}
+		ipNets = append(ipNets, ipNet)
+	}
+
+	return ipNets, nil
+}
+
+// normalizeHost returns the lower case host without the trailing dot, so "Example.COM." matches "example.com"
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+func normalizeHosts(hosts []string) []string {
+	normalized := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		normalized = append(normalized, normalizeHost(host))
+	}
+
+	return normalized
+}
+
+func intSet(values []int) map[int]bool {
+	set := make(map[int]bool, len(values))
+	for _, value := range values {
+		set[value] = true
+	}
+
+	return set
+}
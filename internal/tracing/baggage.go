@@ -0,0 +1,68 @@
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+const (
+	BaggageKeyID      = "baggID"
+	BaggageKeyCommand = "baggCommand"
+
+	DefaultBaggageAttributePrefix = "baggage."
+
+	baggageKeyAny = "*"
+)
+
+/*
+BaggageProcessor copies the allowed baggage members of the parent context onto every started span,
+as prefix+key attributes. If the allowlist contains *, all members are copied.
+*/
+type BaggageProcessor struct {
+	keys   map[string]bool
+	allKey bool
+	prefix string
+}
+
+func NewBaggageProcessor(keys []string, prefix string) *BaggageProcessor {
+	p := &BaggageProcessor{
+		keys:   map[string]bool{},
+		prefix: prefix,
+	}
+	for _, key := range keys {
+		if key == baggageKeyAny {
+			p.allKey = true
+		} else if key != "" {
+			p.keys[key] = true
+		}
+	}
+
+	return p
+}
+
+func (p *BaggageProcessor) OnStart(parent context.Context, span sdktrace.ReadWriteSpan) {
+	members := baggage.FromContext(parent).Members()
+	if len(members) == 0 {
+		return
+	}
+	attrs := make([]attribute.KeyValue, 0, len(members))
+	for _, member := range members {
+		if p.allKey || p.keys[member.Key()] {
+			attrs = append(attrs, attribute.String(p.prefix+member.Key(), member.Value()))
+		}
+	}
+	span.SetAttributes(attrs...)
+}
+
+func (p *BaggageProcessor) OnEnd(span sdktrace.ReadOnlySpan) {}
+
+func (p *BaggageProcessor) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+func (p *BaggageProcessor) ForceFlush(ctx context.Context) error {
+	return nil
+}
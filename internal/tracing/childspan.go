@@ -0,0 +1,50 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SpanKeyResendCount is the ordinal number of the resent request (not set on the first attempt)
+const SpanKeyResendCount = attribute.Key("http.resend_count")
+
+type (
+	childSpanKey   struct{}
+	resendCountKey struct{}
+)
+
+/*
+ContextWithChildSpan returns a context, which captures the span context of the outgoing client span
+(started by otelhttp.Transport), if the inner transport is wrapped by ChildSpanTransport.
+The captured span context is valid even if the call failed.
+*/
+func ContextWithChildSpan(ctx context.Context) (context.Context, *trace.SpanContext) {
+	spanContext := &trace.SpanContext{}
+
+	return context.WithValue(ctx, childSpanKey{}, spanContext), spanContext
+}
+
+// ContextWithResendCount sets the http.resend_count attribute of the client span, see ChildSpanTransport
+func ContextWithResendCount(ctx context.Context, resendCount int) context.Context {
+	return context.WithValue(ctx, resendCountKey{}, resendCount)
+}
+
+/*
+ChildSpanTransport stores the span context of the request to the holder of ContextWithChildSpan
+and sets the resend count of ContextWithResendCount on the client span.
+*/
+func ChildSpanTransport(next http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if spanContext, has := req.Context().Value(childSpanKey{}).(*trace.SpanContext); has {
+			*spanContext = trace.SpanContextFromContext(req.Context())
+		}
+		if resendCount, has := req.Context().Value(resendCountKey{}).(int); has && resendCount > 0 {
+			trace.SpanFromContext(req.Context()).SetAttributes(SpanKeyResendCount.Int(resendCount))
+		}
+
+		return next.RoundTrip(req)
+	})
+}
@@ -0,0 +1,147 @@
+package tracing
+
+import (
+	"time"
+
+	"github.com/go-logr/logr"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Config is the tracing part of the service configs.
+// It's embedded (squashed) into the service configs, so the keys are the command line flags.
+type Config struct {
+	// JaegerURL is the legacy exporter address, used if ExporterURL is empty
+	JaegerURL string
+	// Exporter is the exporter type. If empty, it's selected by the scheme of the URL
+	Exporter string
+	// ExporterURL is the collector address, for example grpc://localhost:4317
+	ExporterURL string
+	// ExporterHeaders are key=value pairs, sent with every export request
+	ExporterHeaders []string
+	// ExporterCompression is gzip or none
+	ExporterCompression string
+	// ExporterInsecure disables TLS
+	ExporterInsecure bool
+	// ExporterTLSSkipVerify skips the verification of the collector certificate
+	ExporterTLSSkipVerify bool
+	ExporterCAFile        string
+	ExporterCertFile      string
+	ExporterKeyFile       string
+
+	// ExportBatchTimeout is the max delay of the export of an ended span, see sdktrace.WithBatchTimeout
+	ExportBatchTimeout time.Duration
+
+	// ResourceAttr are key=value pairs, merged into the detected resource attributes
+	ResourceAttr []string
+
+	// ExportQueue* are the fields of ExportQueueConfig, the queue is enabled, if ExportQueueDir is set
+	ExportQueueDir        string
+	ExportQueueMaxBatches int
+	ExportQueueRetryMin   time.Duration
+	ExportQueueRetryMax   time.Duration
+
+	// Sampler is the sampler spec, see NewSampler
+	Sampler string
+	// SamplerRules are "METHOD ROUTE=SPEC" rules, see NewSampler
+	SamplerRules []string
+
+	// Propagators are OTEL_PROPAGATORS names, see NewPropagator
+	Propagators []string
+
+	// OpenTracingBridge installs the OpenTracing bridge as the global OpenTracing tracer
+	OpenTracingBridge bool
+
+	// BaggageAttributes are the baggage keys, which are copied onto the spans (* for all), see BaggageProcessor
+	BaggageAttributes      []string
+	BaggageAttributePrefix string
+
+	// Redact* are the rules of RedactionConfig
+	RedactQueryParams []string
+	RedactHeaders     []string
+	RedactAttributes  []string
+	AllowAttributes   []string
+
+	// TailSampling enables TailSamplingProcessor, see the TailSampling* fields and TailSamplingConfig
+	TailSampling             bool
+	TailSamplingLatency      time.Duration
+	TailSamplingAttributes   []string
+	TailSamplingDecisionWait time.Duration
+	TailSamplingMaxTraces    int
+	TailSamplingMaxSpans     int
+}
+
+func (c *Config) SetJaegerURL(url string) {
+	c.JaegerURL = url
+}
+
+// TracerOptions returns the options of InitTracer by the config
+func (c *Config) TracerOptions(log logr.Logger) ([]TracerOption, error) {
+	options := []TracerOption{}
+
+	resourceAttributes, err := ParseResourceAttributes(c.ResourceAttr)
+	if err != nil {
+		return nil, err
+	}
+	options = append(options, WithResourceAttributes(resourceAttributes...))
+
+	if c.ExportBatchTimeout > 0 {
+		options = append(options, WithExportBatchTimeout(c.ExportBatchTimeout))
+	}
+
+	if c.ExportQueueDir != "" {
+		exportQueue, err := NewPersistentExporter(ExportQueueConfig{
+			Dir:        c.ExportQueueDir,
+			MaxBatches: c.ExportQueueMaxBatches,
+			RetryMin:   c.ExportQueueRetryMin,
+			RetryMax:   c.ExportQueueRetryMax,
+		}, log)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, WithExportQueue(exportQueue))
+	}
+
+	if c.OpenTracingBridge {
+		propagator, err := NewPropagator(c.Propagators) //nolint:govet // err shadow
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, WithOpenTracingBridge(propagator))
+	}
+
+	if len(c.BaggageAttributes) > 0 {
+		options = append(options, WithSpanProcessor(NewBaggageProcessor(c.BaggageAttributes, c.BaggageAttributePrefix)))
+	}
+
+	redactionConfig := RedactionConfig{
+		QueryParams:   c.RedactQueryParams,
+		Headers:       c.RedactHeaders,
+		AttributeKeys: c.RedactAttributes,
+		AllowedKeys:   c.AllowAttributes,
+	}
+	if redactionConfig.IsEnabled() {
+		redactor, err := NewRedactor(redactionConfig)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, WithRedaction(redactor))
+	}
+
+	if c.TailSampling {
+		tailSamplingConfig := TailSamplingConfig{
+			Latency:      c.TailSamplingLatency,
+			Attributes:   c.TailSamplingAttributes,
+			DecisionWait: c.TailSamplingDecisionWait,
+			MaxTraces:    c.TailSamplingMaxTraces,
+			MaxSpans:     c.TailSamplingMaxSpans,
+		}
+		if err := tailSamplingConfig.Validate(); err != nil {
+			return nil, err
+		}
+		options = append(options, WithExportWrapper(func(next sdktrace.SpanProcessor) sdktrace.SpanProcessor {
+			return NewTailSamplingProcessor(next, tailSamplingConfig, log)
+		}))
+	}
+
+	return options, nil
+}
@@ -0,0 +1,135 @@
+package tracing
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	ExemplarKeyTraceID = "trace_id"
+	ExemplarKeySpanID  = "span_id"
+
+	// exemplarMaxAge is the age, after a faster request replaces the exemplar of the bucket
+	exemplarMaxAge = time.Minute
+)
+
+// DurationBuckets are the bucket boundaries (milliseconds) of the duration histograms, same as the OpenTelemetry default
+var DurationBuckets = []float64{0, 5, 10, 25, 50, 75, 100, 250, 500, 750, 1000, 2500, 5000, 7500, 10000} //nolint:gochecknoglobals,gomnd // constant
+
+type exemplar struct {
+	value       float64
+	spanContext trace.SpanContext
+	timestamp   time.Time
+}
+
+type exemplarSeries struct {
+	labelValues []string
+	count       uint64
+	sum         float64
+	// counts and exemplars are per bucket (not cumulative), the last one is the +Inf bucket
+	counts    []uint64
+	exemplars []*exemplar
+}
+
+/*
+ExemplarHistogram is a Prometheus histogram, which keeps the slowest sampled request of each bucket as exemplar
+(with trace_id and span_id labels), so the alerts can link to a representative trace.
+The OpenTelemetry metric SDK does not support exemplars yet, so it's registered directly in the Prometheus registry.
+The exemplars are exposed only in OpenMetrics format, see MetricsHandler.
+*/
+type ExemplarHistogram struct {
+	desc    *prometheus.Desc
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*exemplarSeries
+}
+
+func NewExemplarHistogram(name string, help string, buckets []float64, labelNames ...string) *ExemplarHistogram {
+	return &ExemplarHistogram{
+		desc:    prometheus.NewDesc(name, help, labelNames, nil),
+		buckets: buckets,
+		series:  map[string]*exemplarSeries{},
+	}
+}
+
+// Observe records the value, the sampled span context is kept as exemplar, if the value is the slowest of the bucket
+func (h *ExemplarHistogram) Observe(value float64, spanContext trace.SpanContext, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+	bucket := sort.SearchFloat64s(h.buckets, value)
+	now := time.Now()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	series, has := h.series[key]
+	if !has {
+		series = &exemplarSeries{
+			labelValues: labelValues,
+			counts:      make([]uint64, len(h.buckets)+1),
+			exemplars:   make([]*exemplar, len(h.buckets)+1),
+		}
+		h.series[key] = series
+	}
+	series.count++
+	series.sum += value
+	series.counts[bucket]++
+
+	if !spanContext.IsValid() || !spanContext.IsSampled() {
+		return
+	}
+	if current := series.exemplars[bucket]; current == nil || value >= current.value || now.Sub(current.timestamp) > exemplarMaxAge {
+		series.exemplars[bucket] = &exemplar{value: value, spanContext: spanContext, timestamp: now}
+	}
+}
+
+func (h *ExemplarHistogram) Describe(ch chan<- *prometheus.Desc) {
+	ch <- h.desc
+}
+
+func (h *ExemplarHistogram) Collect(ch chan<- prometheus.Metric) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, series := range h.series {
+		buckets := make(map[float64]uint64, len(h.buckets))
+		var cumulative uint64
+		for b, upperBound := range h.buckets {
+			cumulative += series.counts[b]
+			buckets[upperBound] = cumulative
+		}
+		metric, err := prometheus.NewConstHistogram(h.desc, series.count, series.sum, buckets, series.labelValues...)
+		if err != nil {
+			ch <- prometheus.NewInvalidMetric(h.desc, err)
+
+			continue
+		}
+
+		exemplars := []prometheus.Exemplar{}
+		for _, e := range series.exemplars {
+			if e != nil {
+				exemplars = append(exemplars, prometheus.Exemplar{
+					Value: e.value,
+					Labels: prometheus.Labels{
+						ExemplarKeyTraceID: e.spanContext.TraceID().String(),
+						ExemplarKeySpanID:  e.spanContext.SpanID().String(),
+					},
+					Timestamp: e.timestamp,
+				})
+			}
+		}
+		if len(exemplars) > 0 {
+			if metric, err = prometheus.NewMetricWithExemplars(metric, exemplars...); err != nil {
+				ch <- prometheus.NewInvalidMetric(h.desc, err)
+
+				continue
+			}
+		}
+
+		ch <- metric
+	}
+}
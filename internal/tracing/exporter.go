@@ -0,0 +1,390 @@
+package tracing
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc/credentials"
+	_ "google.golang.org/grpc/encoding/gzip" // registers gzip compressor for OTLP/gRPC
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	ExporterAuto         = ""
+	ExporterNone         = "none"
+	ExporterJaeger       = "jaeger"
+	ExporterOtlpGrpc     = "otlpgrpc"
+	ExporterOtlpHTTP     = "otlphttp"
+	ExporterOtlpHTTPJSON = "otlphttpjson"
+
+	CompressionGzip = "gzip"
+	CompressionNone = "none"
+
+	otlpTracesPath = "/v1/traces"
+
+	DefaultOtlpGrpcURL     = "grpc://localhost:4317"
+	DefaultOtlpHTTPURL     = "otlp+http://localhost:4318"
+	DefaultOtlpHTTPJSONURL = "otlp+json://localhost:4318"
+)
+
+var ErrUnknownExporter = errors.NewPlain("unknown exporter")
+
+/*
+NewExporter creates a span exporter by the config.
+The exporter type is selected by the Exporter field or the scheme of the URL:
+
+	""                       none
+	grpc, otlp+grpc          OTLP/gRPC, plain text
+	grpcs, otlp+grpcs        OTLP/gRPC, TLS
+	otlp+http, otlp+https    OTLP/HTTP, protobuf
+	otlp+json, otlp+jsons    OTLP/HTTP, JSON
+	http, https              Jaeger collector (legacy)
+
+The OTLP/HTTP URL path is /v1/traces, if not set.
+If the URL is empty, the default endpoint of the selected OTLP exporter is used (localhost:4317 or localhost:4318),
+otherwise the legacy JaegerURL.
+Returns nil exporter, if the exporter is none.
+*/
+func NewExporter(ctx context.Context, cfg Config) (sdktrace.SpanExporter, error) {
+	rawURL := cfg.ExporterURL
+	if rawURL == "" {
+		rawURL = defaultExporterURL(cfg.Exporter, cfg.JaegerURL)
+	}
+	if rawURL == "-" {
+		rawURL = ""
+	}
+
+	exporterType, endpoint, err := parseExporterURL(cfg.Exporter, rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	switch exporterType {
+	case ExporterNone:
+		return nil, nil
+	case ExporterJaeger:
+		return JaegerProvider(endpoint.String())
+	case ExporterOtlpGrpc:
+		return newOtlpGrpcExporter(ctx, cfg, endpoint)
+	case ExporterOtlpHTTP:
+		return newOtlpHTTPExporter(ctx, cfg, endpoint)
+	case ExporterOtlpHTTPJSON:
+		return newOtlpJSONExporter(ctx, cfg, endpoint)
+	default:
+		return nil, errors.WithDetails(ErrUnknownExporter, "exporter", exporterType)
+	}
+}
+
+// defaultExporterURL returns the default endpoint of the explicitly selected OTLP exporter, or the legacy Jaeger URL
+func defaultExporterURL(exporterType string, jaegerURL string) string {
+	switch exporterType {
+	case ExporterOtlpGrpc:
+		return DefaultOtlpGrpcURL
+	case ExporterOtlpHTTP:
+		return DefaultOtlpHTTPURL
+	case ExporterOtlpHTTPJSON:
+		return DefaultOtlpHTTPJSONURL
+	default:
+		return jaegerURL
+	}
+}
+
+func parseExporterURL(exporterType string, rawURL string) (string, *url.URL, error) {
+	if rawURL == "" {
+		if exporterType == ExporterAuto {
+			return ExporterNone, nil, nil
+		}
+		if exporterType != ExporterNone {
+			return "", nil, errors.WithDetails(errors.NewPlain("missing exporter URL"), "exporter", exporterType)
+		}
+
+		return ExporterNone, nil, nil
+	}
+
+	endpoint, err := url.Parse(rawURL)
+	if err != nil {
+		return "", nil, errors.WrapWithDetails(err, "invalid exporter URL", "url", rawURL)
+	}
+
+	scheme := strings.ToLower(endpoint.Scheme)
+	secure := strings.HasSuffix(scheme, "s")
+	schemeType := ""
+	switch scheme {
+	case "grpc", "grpcs", "otlp+grpc", "otlp+grpcs":
+		schemeType = ExporterOtlpGrpc
+	case "otlp+http", "otlp+https":
+		schemeType = ExporterOtlpHTTP
+	case "otlp+json", "otlp+jsons":
+		schemeType = ExporterOtlpHTTPJSON
+	case "http", "https", "jaeger+http", "jaeger+https":
+		schemeType = ExporterJaeger
+	default:
+		return "", nil, errors.WithDetails(ErrUnknownExporter, "url", rawURL)
+	}
+	if secure {
+		endpoint.Scheme = "https"
+	} else {
+		endpoint.Scheme = "http"
+	}
+
+	if exporterType == ExporterAuto {
+		exporterType = schemeType
+	}
+
+	return exporterType, endpoint, nil
+}
+
+func newOtlpGrpcExporter(ctx context.Context, cfg Config, endpoint *url.URL) (sdktrace.SpanExporter, error) {
+	headers, err := parseExporterHeaders(cfg.ExporterHeaders)
+	if err != nil {
+		return nil, err
+	}
+	options := []otlptracegrpc.Option{
+		otlptracegrpc.WithEndpoint(endpoint.Host),
+		otlptracegrpc.WithHeaders(headers),
+	}
+	if cfg.ExporterCompression == CompressionGzip {
+		options = append(options, otlptracegrpc.WithCompressor(CompressionGzip))
+	}
+	if cfg.ExporterInsecure || endpoint.Scheme == "http" {
+		options = append(options, otlptracegrpc.WithInsecure())
+	} else {
+		tlsConfig, err := newExporterTLSConfig(cfg) //nolint:govet // err shadow
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, otlptracegrpc.WithTLSCredentials(credentials.NewTLS(tlsConfig)))
+	}
+
+	return otlptracegrpc.New(ctx, options...)
+}
+
+func newOtlpHTTPExporter(ctx context.Context, cfg Config, endpoint *url.URL) (sdktrace.SpanExporter, error) {
+	headers, err := parseExporterHeaders(cfg.ExporterHeaders)
+	if err != nil {
+		return nil, err
+	}
+	urlPath := endpoint.Path
+	if urlPath == "" || urlPath == "/" {
+		urlPath = otlpTracesPath
+	}
+	options := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(endpoint.Host),
+		otlptracehttp.WithURLPath(urlPath),
+		otlptracehttp.WithHeaders(headers),
+	}
+	if cfg.ExporterCompression == CompressionGzip {
+		options = append(options, otlptracehttp.WithCompression(otlptracehttp.GzipCompression))
+	}
+	if cfg.ExporterInsecure || endpoint.Scheme == "http" {
+		options = append(options, otlptracehttp.WithInsecure())
+	} else {
+		tlsConfig, err := newExporterTLSConfig(cfg) //nolint:govet // err shadow
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, otlptracehttp.WithTLSClientConfig(tlsConfig))
+	}
+
+	return otlptracehttp.New(ctx, options...)
+}
+
+func newOtlpJSONExporter(ctx context.Context, cfg Config, endpoint *url.URL) (sdktrace.SpanExporter, error) {
+	headers, err := parseExporterHeaders(cfg.ExporterHeaders)
+	if err != nil {
+		return nil, err
+	}
+	if endpoint.Path == "" || endpoint.Path == "/" {
+		endpoint.Path = otlpTracesPath
+	}
+	if cfg.ExporterInsecure {
+		endpoint.Scheme = "http"
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone() //nolint:forcetypeassert // always *http.Transport
+	if endpoint.Scheme == "https" {
+		if transport.TLSClientConfig, err = newExporterTLSConfig(cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	return otlptrace.New(ctx, &otlpJSONClient{
+		endpoint:    endpoint.String(),
+		headers:     headers,
+		compression: cfg.ExporterCompression,
+		httpClient:  &http.Client{Transport: transport, Timeout: 10 * time.Second}, //nolint:gomnd // OTLP default
+	})
+}
+
+func parseExporterHeaders(pairs []string) (map[string]string, error) {
+	headers := map[string]string{}
+	for _, pair := range pairs {
+		if pair == "" {
+			continue
+		}
+		key, value, found := strings.Cut(pair, "=")
+		if !found {
+			return nil, errors.WithDetails(errors.NewPlain("invalid exporter header"), "header", pair)
+		}
+		headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+
+	return headers, nil
+}
+
+func newExporterTLSConfig(cfg Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{ //nolint:gosec // InsecureSkipVerify is configurable
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.ExporterTLSSkipVerify,
+	}
+	if cfg.ExporterCAFile != "" {
+		caPEM, err := os.ReadFile(cfg.ExporterCAFile)
+		if err != nil {
+			return nil, errors.WrapWithDetails(err, "unable to read CA file", "path", cfg.ExporterCAFile)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caPEM) {
+			return nil, errors.WithDetails(errors.NewPlain("invalid CA file"), "path", cfg.ExporterCAFile)
+		}
+	}
+	if cfg.ExporterCertFile != "" || cfg.ExporterKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.ExporterCertFile, cfg.ExporterKeyFile)
+		if err != nil {
+			return nil, errors.WrapWithDetails(err, "unable to load client certificate",
+				"cert", cfg.ExporterCertFile, "key", cfg.ExporterKeyFile,
+			)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// otlpJSONClient is an OTLP/HTTP client with JSON encoding, which is not supported by otlptracehttp.
+type otlpJSONClient struct {
+	endpoint    string
+	headers     map[string]string
+	compression string
+	httpClient  *http.Client
+}
+
+func (c *otlpJSONClient) Start(ctx context.Context) error {
+	return nil
+}
+
+func (c *otlpJSONClient) Stop(ctx context.Context) error {
+	c.httpClient.CloseIdleConnections()
+
+	return nil
+}
+
+func (c *otlpJSONClient) UploadTraces(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+	body, err := marshalOtlpJSON(&coltracepb.ExportTraceServiceRequest{ResourceSpans: protoSpans})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "unable to create OTLP request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range c.headers {
+		req.Header.Set(key, value)
+	}
+	if c.compression == CompressionGzip {
+		if req.Body, err = gzipBody(body); err != nil {
+			return err
+		}
+		req.ContentLength = -1
+		req.Header.Set("Content-Encoding", CompressionGzip)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "unable to send OTLP request")
+	}
+	defer resp.Body.Close()               //nolint:errcheck // not important
+	_, _ = io.Copy(io.Discard, resp.Body) //nolint:errcheck // drain
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return errors.WithDetails(errors.NewPlain("OTLP export failed"), "status", resp.Status)
+	}
+
+	return nil
+}
+
+/*
+marshalOtlpJSON encodes the request by the OTLP/JSON rules:
+trace and span IDs are hex strings instead of base64 (used by protojson), enums are numbers.
+*/
+func marshalOtlpJSON(req proto.Message) ([]byte, error) {
+	raw, err := protojson.MarshalOptions{UseEnumNumbers: true}.Marshal(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to marshal OTLP request")
+	}
+	var doc interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, errors.Wrap(err, "unable to unmarshal OTLP request")
+	}
+	if err := hexEncodeIDs(doc); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(doc) //nolint:wrapcheck // simple marshal
+}
+
+func hexEncodeIDs(node interface{}) error {
+	switch value := node.(type) {
+	case map[string]interface{}:
+		for key, item := range value {
+			if id, is := item.(string); is && (key == "traceId" || key == "spanId" || key == "parentSpanId") {
+				decoded, err := base64.StdEncoding.DecodeString(id)
+				if err != nil {
+					return errors.WrapWithDetails(err, "invalid ID", "key", key)
+				}
+				value[key] = hex.EncodeToString(decoded)
+			} else if err := hexEncodeIDs(item); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range value {
+			if err := hexEncodeIDs(item); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func gzipBody(body []byte) (io.ReadCloser, error) {
+	buf := &bytes.Buffer{}
+	zw := gzip.NewWriter(buf)
+	if _, err := zw.Write(body); err != nil {
+		return nil, errors.Wrap(err, "unable to compress")
+	}
+	if err := zw.Close(); err != nil {
+		return nil, errors.Wrap(err, "unable to compress")
+	}
+
+	return io.NopCloser(buf), nil
+}
@@ -0,0 +1,652 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric/global"
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.opentelemetry.io/otel/metric/instrument/syncint64"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	exportQueueFileExt    = ".json"
+	exportQueueTmpExt     = ".tmp"
+	exportQueueReplayWait = 30 * time.Second
+
+	MeterNameTracing = "github.com/pgillich/opentracing-example/internal/tracing"
+)
+
+// ExportQueueConfig is the config of PersistentExporter
+type ExportQueueConfig struct {
+	// Dir is the directory of the spooled batches, a batch is a file
+	Dir string
+	// MaxBatches is the max number of the spooled batches, the oldest batch is dropped, if it's exceeded
+	MaxBatches int
+	// RetryMin is the initial wait between the replays, it's doubled after every failed replay
+	RetryMin time.Duration
+	// RetryMax is the max wait between the replays
+	RetryMax time.Duration
+}
+
+type queuedBatch struct {
+	path  string
+	seq   uint64
+	spans int
+}
+
+type exportQueueMetrics struct {
+	spooled  syncint64.Counter
+	replayed syncint64.Counter
+	dropped  syncint64.Counter
+}
+
+/*
+PersistentExporter wraps a SpanExporter. If the export fails, the batch is spooled to the disk queue
+and it's replayed with exponential backoff, when the endpoint comes back. While the queue isn't empty,
+the new batches are spooled, too, so the order of the batches is kept.
+The queue is bounded by MaxBatches, the oldest batch is dropped, if it's full.
+The spooled batches survive the restart of the process.
+
+The queue depth and the number of spooled, replayed and dropped spans are logged and
+reported by the global MeterProvider (exporter.queue.* instruments).
+*/
+type PersistentExporter struct {
+	next    sdktrace.SpanExporter
+	config  ExportQueueConfig
+	log     logr.Logger
+	metrics exportQueueMetrics
+
+	exportMu sync.Mutex // serializes the exports of the next exporter
+
+	mu      sync.Mutex
+	batches []queuedBatch
+	nextSeq uint64
+	depth   int64
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewPersistentExporter creates the queue directory and loads the spooled batches. It's started by WithExportQueue.
+func NewPersistentExporter(config ExportQueueConfig, log logr.Logger) (*PersistentExporter, error) {
+	if err := os.MkdirAll(config.Dir, 0o750); err != nil { //nolint:gomnd // rwxr-x---
+		return nil, errors.WrapWithDetails(err, "unable to create export queue dir", "dir", config.Dir)
+	}
+	if config.RetryMin <= 0 {
+		config.RetryMin = time.Second
+	}
+	if config.RetryMax < config.RetryMin {
+		config.RetryMax = config.RetryMin
+	}
+
+	e := &PersistentExporter{
+		config: config,
+		log:    log.WithName("exportQueue"),
+		stop:   make(chan struct{}),
+	}
+	if err := e.load(); err != nil {
+		return nil, err
+	}
+	e.initMetrics()
+
+	return e, nil
+}
+
+func (e *PersistentExporter) load() error {
+	entries, err := os.ReadDir(e.config.Dir)
+	if err != nil {
+		return errors.WrapWithDetails(err, "unable to read export queue dir", "dir", e.config.Dir)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, exportQueueFileExt) {
+			continue
+		}
+		seqText, spansText, found := strings.Cut(strings.TrimSuffix(name, exportQueueFileExt), "-")
+		seq, seqErr := strconv.ParseUint(seqText, 10, 64)
+		spans, spansErr := strconv.Atoi(spansText)
+		if !found || seqErr != nil || spansErr != nil {
+			e.log.Info("Unknown file in the export queue dir", "file", name)
+
+			continue
+		}
+		e.batches = append(e.batches, queuedBatch{path: filepath.Join(e.config.Dir, name), seq: seq, spans: spans})
+		e.depth += int64(spans)
+		if seq >= e.nextSeq {
+			e.nextSeq = seq + 1
+		}
+	}
+	sort.Slice(e.batches, func(i, j int) bool {
+		return e.batches[i].seq < e.batches[j].seq
+	})
+	if len(e.batches) > 0 {
+		e.log.Info("Spooled batches loaded", "batches", len(e.batches), "spans", e.depth)
+	}
+
+	return nil
+}
+
+func (e *PersistentExporter) initMetrics() {
+	meter := global.Meter(MeterNameTracing)
+	var err error
+	if e.metrics.spooled, err = meter.SyncInt64().Counter("exporter.queue.spooled",
+		instrument.WithDescription("Number of the spans written to the export queue")); err != nil {
+		e.log.Error(err, "unable to create metric")
+	}
+	if e.metrics.replayed, err = meter.SyncInt64().Counter("exporter.queue.replayed",
+		instrument.WithDescription("Number of the spans exported from the export queue")); err != nil {
+		e.log.Error(err, "unable to create metric")
+	}
+	if e.metrics.dropped, err = meter.SyncInt64().Counter("exporter.queue.dropped",
+		instrument.WithDescription("Number of the spans dropped from the full export queue")); err != nil {
+		e.log.Error(err, "unable to create metric")
+	}
+	depth, err := meter.AsyncInt64().Gauge("exporter.queue.depth",
+		instrument.WithDescription("Number of the spans in the export queue"))
+	if err != nil {
+		e.log.Error(err, "unable to create metric")
+
+		return
+	}
+	if err := meter.RegisterCallback([]instrument.Asynchronous{depth}, func(ctx context.Context) {
+		depth.Observe(ctx, e.Depth())
+	}); err != nil {
+		e.log.Error(err, "unable to register metric callback")
+	}
+}
+
+func (e *PersistentExporter) addMetric(counter syncint64.Counter, value int) {
+	if counter != nil {
+		counter.Add(context.Background(), int64(value))
+	}
+}
+
+// Depth returns the number of the spooled spans
+func (e *PersistentExporter) Depth() int64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.depth
+}
+
+// start sets the wrapped exporter and starts the replay
+func (e *PersistentExporter) start(next sdktrace.SpanExporter) sdktrace.SpanExporter {
+	e.next = next
+	e.wg.Add(1)
+	go e.replay()
+
+	return e
+}
+
+// WithExportQueue wraps the exporter by the PersistentExporter
+func WithExportQueue(exporter *PersistentExporter) TracerOption {
+	return func(options *tracerOptions) {
+		options.exportQueue = exporter
+	}
+}
+
+// ExportSpans exports the spans or spools them, if the export fails or the queue isn't empty
+func (e *PersistentExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	if len(spans) == 0 {
+		return nil
+	}
+	if e.Depth() == 0 {
+		e.exportMu.Lock()
+		err := e.next.ExportSpans(ctx, spans)
+		e.exportMu.Unlock()
+		if err == nil {
+			return nil
+		}
+		e.log.Error(err, "Export failed, spooling spans", "spans", len(spans))
+	}
+
+	return e.spool(spans)
+}
+
+func (e *PersistentExporter) spool(spans []sdktrace.ReadOnlySpan) error {
+	data, err := json.Marshal(newSpooledSpans(spans))
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal spans")
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	batch := queuedBatch{seq: e.nextSeq, spans: len(spans)}
+	batch.path = filepath.Join(e.config.Dir, fmt.Sprintf("%020d-%d%s", batch.seq, batch.spans, exportQueueFileExt))
+	tmpPath := batch.path + exportQueueTmpExt
+	if err := os.WriteFile(tmpPath, data, 0o600); err != nil { //nolint:gomnd // rw-------
+		return errors.WrapWithDetails(err, "unable to write export queue file", "file", tmpPath)
+	}
+	if err := os.Rename(tmpPath, batch.path); err != nil {
+		return errors.WrapWithDetails(err, "unable to rename export queue file", "file", tmpPath)
+	}
+	e.nextSeq++
+	e.batches = append(e.batches, batch)
+	e.depth += int64(batch.spans)
+	e.addMetric(e.metrics.spooled, batch.spans)
+
+	for e.config.MaxBatches > 0 && len(e.batches) > e.config.MaxBatches {
+		dropped := e.batches[0]
+		e.batches = e.batches[1:]
+		e.depth -= int64(dropped.spans)
+		if err := os.Remove(dropped.path); err != nil {
+			e.log.Error(err, "unable to remove export queue file", "file", dropped.path)
+		}
+		e.addMetric(e.metrics.dropped, dropped.spans)
+		e.log.Info("Export queue is full, spans dropped", "spans", dropped.spans, "depth", e.depth)
+	}
+
+	return nil
+}
+
+func (e *PersistentExporter) replay() {
+	defer e.wg.Done()
+	wait := e.config.RetryMin
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-e.stop:
+			return
+		case <-timer.C:
+		}
+
+		for {
+			replayed, err := e.replayOldest()
+			if err != nil {
+				wait *= 2
+				if wait > e.config.RetryMax {
+					wait = e.config.RetryMax
+				}
+				e.log.Error(err, "Replay failed", "depth", e.Depth(), "retryAfter", wait)
+
+				break
+			}
+			wait = e.config.RetryMin
+			if !replayed {
+				break
+			}
+		}
+		timer.Reset(wait)
+	}
+}
+
+// replayOldest exports the oldest spooled batch. Returns false, if the queue is empty.
+func (e *PersistentExporter) replayOldest() (bool, error) {
+	e.mu.Lock()
+	if len(e.batches) == 0 {
+		e.mu.Unlock()
+
+		return false, nil
+	}
+	batch := e.batches[0]
+	e.mu.Unlock()
+
+	data, err := os.ReadFile(batch.path)
+	if err != nil {
+		e.removeBatch(batch, true)
+
+		return true, errors.WrapWithDetails(err, "unable to read export queue file", "file", batch.path)
+	}
+	spooledSpans := []spooledSpan{}
+	if err := json.Unmarshal(data, &spooledSpans); err != nil {
+		e.removeBatch(batch, true)
+
+		return true, errors.WrapWithDetails(err, "unable to unmarshal export queue file", "file", batch.path)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), exportQueueReplayWait)
+	defer cancel()
+	e.exportMu.Lock()
+	err = e.next.ExportSpans(ctx, spooledToSpans(spooledSpans))
+	e.exportMu.Unlock()
+	if err != nil {
+		return false, errors.Wrap(err, "unable to export spooled spans")
+	}
+	e.removeBatch(batch, false)
+	e.log.Info("Spooled spans exported", "spans", batch.spans, "depth", e.Depth())
+
+	return true, nil
+}
+
+func (e *PersistentExporter) removeBatch(batch queuedBatch, dropped bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if len(e.batches) == 0 || e.batches[0].seq != batch.seq {
+		return // dropped by spool
+	}
+	e.batches = e.batches[1:]
+	e.depth -= int64(batch.spans)
+	if err := os.Remove(batch.path); err != nil && !os.IsNotExist(err) {
+		e.log.Error(err, "unable to remove export queue file", "file", batch.path)
+	}
+	if dropped {
+		e.addMetric(e.metrics.dropped, batch.spans)
+	} else {
+		e.addMetric(e.metrics.replayed, batch.spans)
+	}
+}
+
+// Shutdown stops the replay and shuts down the wrapped exporter. The spooled batches are kept on the disk.
+func (e *PersistentExporter) Shutdown(ctx context.Context) error {
+	e.stopOnce.Do(func() {
+		close(e.stop)
+	})
+	e.wg.Wait()
+	if depth := e.Depth(); depth > 0 {
+		e.log.Info("Spans left in the export queue", "spans", depth, "dir", e.config.Dir)
+	}
+
+	return e.next.Shutdown(ctx) //nolint:wrapcheck // transparent wrapper
+}
+
+/*
+spooledSpan is the JSON form of a span in the export queue.
+The SDK types (attribute.Value, trace.SpanContext) can't be unmarshaled, so the values are stored by type.
+*/
+type spooledSpan struct {
+	Name              string                `json:"name"`
+	SpanContext       spooledSpanContext    `json:"spanContext"`
+	Parent            spooledSpanContext    `json:"parent"`
+	Kind              trace.SpanKind        `json:"kind"`
+	StartTime         time.Time             `json:"startTime"`
+	EndTime           time.Time             `json:"endTime"`
+	Attributes        []spooledAttribute    `json:"attributes,omitempty"`
+	Events            []spooledEvent        `json:"events,omitempty"`
+	Links             []spooledLink         `json:"links,omitempty"`
+	StatusCode        codes.Code            `json:"statusCode"`
+	StatusDescription string                `json:"statusDescription,omitempty"`
+	DroppedAttributes int                   `json:"droppedAttributes,omitempty"`
+	DroppedEvents     int                   `json:"droppedEvents,omitempty"`
+	DroppedLinks      int                   `json:"droppedLinks,omitempty"`
+	ChildSpanCount    int                   `json:"childSpanCount,omitempty"`
+	Resource          spooledResource       `json:"resource"`
+	Scope             instrumentation.Scope `json:"scope"`
+}
+
+type spooledSpanContext struct {
+	TraceID    string `json:"traceID,omitempty"`
+	SpanID     string `json:"spanID,omitempty"`
+	TraceFlags byte   `json:"traceFlags,omitempty"`
+	TraceState string `json:"traceState,omitempty"`
+	Remote     bool   `json:"remote,omitempty"`
+}
+
+type spooledAttribute struct {
+	Key   string          `json:"key"`
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+type spooledEvent struct {
+	Name                  string             `json:"name"`
+	Time                  time.Time          `json:"time"`
+	Attributes            []spooledAttribute `json:"attributes,omitempty"`
+	DroppedAttributeCount int                `json:"droppedAttributeCount,omitempty"`
+}
+
+type spooledLink struct {
+	SpanContext           spooledSpanContext `json:"spanContext"`
+	Attributes            []spooledAttribute `json:"attributes,omitempty"`
+	DroppedAttributeCount int                `json:"droppedAttributeCount,omitempty"`
+}
+
+type spooledResource struct {
+	SchemaURL  string             `json:"schemaURL,omitempty"`
+	Attributes []spooledAttribute `json:"attributes,omitempty"`
+}
+
+func newSpooledSpans(spans []sdktrace.ReadOnlySpan) []spooledSpan {
+	spooledSpans := make([]spooledSpan, 0, len(spans))
+	for _, span := range spans {
+		spooled := spooledSpan{
+			Name:              span.Name(),
+			SpanContext:       newSpooledSpanContext(span.SpanContext()),
+			Parent:            newSpooledSpanContext(span.Parent()),
+			Kind:              span.SpanKind(),
+			StartTime:         span.StartTime(),
+			EndTime:           span.EndTime(),
+			Attributes:        newSpooledAttributes(span.Attributes()),
+			StatusCode:        span.Status().Code,
+			StatusDescription: span.Status().Description,
+			DroppedAttributes: span.DroppedAttributes(),
+			DroppedEvents:     span.DroppedEvents(),
+			DroppedLinks:      span.DroppedLinks(),
+			ChildSpanCount:    span.ChildSpanCount(),
+			Scope:             span.InstrumentationScope(),
+		}
+		for _, event := range span.Events() {
+			spooled.Events = append(spooled.Events, spooledEvent{
+				Name:                  event.Name,
+				Time:                  event.Time,
+				Attributes:            newSpooledAttributes(event.Attributes),
+				DroppedAttributeCount: event.DroppedAttributeCount,
+			})
+		}
+		for _, link := range span.Links() {
+			spooled.Links = append(spooled.Links, spooledLink{
+				SpanContext:           newSpooledSpanContext(link.SpanContext),
+				Attributes:            newSpooledAttributes(link.Attributes),
+				DroppedAttributeCount: link.DroppedAttributeCount,
+			})
+		}
+		if span.Resource() != nil {
+			spooled.Resource = spooledResource{
+				SchemaURL:  span.Resource().SchemaURL(),
+				Attributes: newSpooledAttributes(span.Resource().Attributes()),
+			}
+		}
+		spooledSpans = append(spooledSpans, spooled)
+	}
+
+	return spooledSpans
+}
+
+func newSpooledSpanContext(spanContext trace.SpanContext) spooledSpanContext {
+	if !spanContext.IsValid() {
+		return spooledSpanContext{}
+	}
+
+	return spooledSpanContext{
+		TraceID:    spanContext.TraceID().String(),
+		SpanID:     spanContext.SpanID().String(),
+		TraceFlags: byte(spanContext.TraceFlags()),
+		TraceState: spanContext.TraceState().String(),
+		Remote:     spanContext.IsRemote(),
+	}
+}
+
+func newSpooledAttributes(attrs []attribute.KeyValue) []spooledAttribute {
+	if len(attrs) == 0 {
+		return nil
+	}
+	spooled := make([]spooledAttribute, 0, len(attrs))
+	for _, attr := range attrs {
+		value, err := json.Marshal(attr.Value.AsInterface())
+		if err != nil {
+			continue
+		}
+		spooled = append(spooled, spooledAttribute{Key: string(attr.Key), Type: attr.Value.Type().String(), Value: value})
+	}
+
+	return spooled
+}
+
+/*
+replayedSpan is a ReadOnlySpan decoded from the export queue.
+ReadOnlySpan has an unexported method, so the interface is embedded (nil), all other methods are implemented.
+*/
+type replayedSpan struct {
+	sdktrace.ReadOnlySpan
+
+	name              string
+	spanContext       trace.SpanContext
+	parent            trace.SpanContext
+	kind              trace.SpanKind
+	startTime         time.Time
+	endTime           time.Time
+	attributes        []attribute.KeyValue
+	links             []sdktrace.Link
+	events            []sdktrace.Event
+	status            sdktrace.Status
+	scope             instrumentation.Scope
+	resource          *resource.Resource
+	droppedAttributes int
+	droppedLinks      int
+	droppedEvents     int
+	childSpanCount    int
+}
+
+func (s *replayedSpan) Name() string                                { return s.name }
+func (s *replayedSpan) SpanContext() trace.SpanContext              { return s.spanContext }
+func (s *replayedSpan) Parent() trace.SpanContext                   { return s.parent }
+func (s *replayedSpan) SpanKind() trace.SpanKind                    { return s.kind }
+func (s *replayedSpan) StartTime() time.Time                        { return s.startTime }
+func (s *replayedSpan) EndTime() time.Time                          { return s.endTime }
+func (s *replayedSpan) Attributes() []attribute.KeyValue            { return s.attributes }
+func (s *replayedSpan) Links() []sdktrace.Link                      { return s.links }
+func (s *replayedSpan) Events() []sdktrace.Event                    { return s.events }
+func (s *replayedSpan) Status() sdktrace.Status                     { return s.status }
+func (s *replayedSpan) InstrumentationScope() instrumentation.Scope { return s.scope }
+func (s *replayedSpan) Resource() *resource.Resource                { return s.resource }
+func (s *replayedSpan) DroppedAttributes() int                      { return s.droppedAttributes }
+func (s *replayedSpan) DroppedLinks() int                           { return s.droppedLinks }
+func (s *replayedSpan) DroppedEvents() int                          { return s.droppedEvents }
+func (s *replayedSpan) ChildSpanCount() int                         { return s.childSpanCount }
+
+func (s *replayedSpan) InstrumentationLibrary() instrumentation.Library {
+	return instrumentation.Library(s.scope)
+}
+
+func spooledToSpans(spooledSpans []spooledSpan) []sdktrace.ReadOnlySpan {
+	resources := map[string]*resource.Resource{}
+	spans := make([]sdktrace.ReadOnlySpan, 0, len(spooledSpans))
+	for _, spooled := range spooledSpans {
+		span := &replayedSpan{
+			name:              spooled.Name,
+			spanContext:       spooled.SpanContext.spanContext(),
+			parent:            spooled.Parent.spanContext(),
+			kind:              spooled.Kind,
+			startTime:         spooled.StartTime,
+			endTime:           spooled.EndTime,
+			attributes:        spooledToAttributes(spooled.Attributes),
+			status:            sdktrace.Status{Code: spooled.StatusCode, Description: spooled.StatusDescription},
+			scope:             spooled.Scope,
+			droppedAttributes: spooled.DroppedAttributes,
+			droppedLinks:      spooled.DroppedLinks,
+			droppedEvents:     spooled.DroppedEvents,
+			childSpanCount:    spooled.ChildSpanCount,
+		}
+		for _, event := range spooled.Events {
+			span.events = append(span.events, sdktrace.Event{
+				Name:                  event.Name,
+				Time:                  event.Time,
+				Attributes:            spooledToAttributes(event.Attributes),
+				DroppedAttributeCount: event.DroppedAttributeCount,
+			})
+		}
+		for _, link := range spooled.Links {
+			span.links = append(span.links, sdktrace.Link{
+				SpanContext:           link.SpanContext.spanContext(),
+				Attributes:            spooledToAttributes(link.Attributes),
+				DroppedAttributeCount: link.DroppedAttributeCount,
+			})
+		}
+
+		// the spans of a process have the same resource, so it's decoded only once
+		resourceKey, _ := json.Marshal(spooled.Resource) //nolint:errchkjson // decoded from JSON
+		res, has := resources[string(resourceKey)]
+		if !has {
+			res = resource.NewWithAttributes(spooled.Resource.SchemaURL, spooledToAttributes(spooled.Resource.Attributes)...)
+			resources[string(resourceKey)] = res
+		}
+		span.resource = res
+
+		spans = append(spans, span)
+	}
+
+	return spans
+}
+
+func (s spooledSpanContext) spanContext() trace.SpanContext {
+	if s.TraceID == "" {
+		return trace.SpanContext{}
+	}
+	config := trace.SpanContextConfig{
+		TraceFlags: trace.TraceFlags(s.TraceFlags),
+		Remote:     s.Remote,
+	}
+	config.TraceID, _ = trace.TraceIDFromHex(s.TraceID)        //nolint:errcheck // encoded by String()
+	config.SpanID, _ = trace.SpanIDFromHex(s.SpanID)           //nolint:errcheck // encoded by String()
+	config.TraceState, _ = trace.ParseTraceState(s.TraceState) //nolint:errcheck // encoded by String()
+
+	return trace.NewSpanContext(config)
+}
+
+func spooledToAttributes(spooled []spooledAttribute) []attribute.KeyValue {
+	attrs := make([]attribute.KeyValue, 0, len(spooled))
+	for _, attr := range spooled {
+		key := attribute.Key(attr.Key)
+		var err error
+		switch attr.Type {
+		case attribute.BOOL.String():
+			var value bool
+			err = json.Unmarshal(attr.Value, &value)
+			attrs = append(attrs, key.Bool(value))
+		case attribute.INT64.String():
+			var value int64
+			err = json.Unmarshal(attr.Value, &value)
+			attrs = append(attrs, key.Int64(value))
+		case attribute.FLOAT64.String():
+			var value float64
+			err = json.Unmarshal(attr.Value, &value)
+			attrs = append(attrs, key.Float64(value))
+		case attribute.BOOLSLICE.String():
+			var value []bool
+			err = json.Unmarshal(attr.Value, &value)
+			attrs = append(attrs, key.BoolSlice(value))
+		case attribute.INT64SLICE.String():
+			var value []int64
+			err = json.Unmarshal(attr.Value, &value)
+			attrs = append(attrs, key.Int64Slice(value))
+		case attribute.FLOAT64SLICE.String():
+			var value []float64
+			err = json.Unmarshal(attr.Value, &value)
+			attrs = append(attrs, key.Float64Slice(value))
+		case attribute.STRINGSLICE.String():
+			var value []string
+			err = json.Unmarshal(attr.Value, &value)
+			attrs = append(attrs, key.StringSlice(value))
+		default:
+			var value string
+			err = json.Unmarshal(attr.Value, &value)
+			attrs = append(attrs, key.String(value))
+		}
+		if err != nil {
+			attrs = attrs[:len(attrs)-1]
+		}
+	}
+
+	return attrs
+}
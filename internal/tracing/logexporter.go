@@ -0,0 +1,301 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/pgillich/opentracing-example/internal/logger"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	DefaultLogExportURL = "http://localhost:4318" + otlpLogsPath
+
+	serviceNamespace = "opentracing-example"
+
+	otlpLogsPath = "/v1/logs"
+
+	logExportInterval   = time.Second
+	logExportTimeout    = 10 * time.Second
+	logExportMaxRecords = 2048
+)
+
+var ErrLogExport = errors.NewPlain("OTLP log export failed")
+
+/*
+NewLogExporter creates an OTLP/HTTP log exporter by the export type:
+
+	otlphttp      protobuf
+	otlphttpjson  JSON
+
+Returns nil exporter for the other types (none, span).
+*/
+func NewLogExporter(exportType string, endpoint string) (logger.RecordExporter, error) {
+	switch exportType {
+	case ExporterOtlpHTTP, ExporterOtlpHTTPJSON:
+	case "", logger.ExportNone, logger.ExportSpan:
+		return nil, nil
+	default:
+		return nil, errors.WithDetails(ErrUnknownExporter, "logExport", exportType)
+	}
+	if endpoint == "" {
+		endpoint = DefaultLogExportURL
+	}
+
+	exporter := &LogExporter{
+		endpoint:   endpoint,
+		json:       exportType == ExporterOtlpHTTPJSON,
+		httpClient: &http.Client{Timeout: logExportTimeout},
+		services:   map[string]logService{},
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	go exporter.run()
+
+	return exporter, nil
+}
+
+/*
+LogExporter sends the log records to an OTLP/HTTP collector in batches (every second).
+If the collector is not available, the records are dropped, so logging is never blocked.
+The trace context of the record is set by the span of the logger, see logger.WithSpan.
+The resource of the records is the resource of the TracerProvider of the service and the records are redacted
+by the redaction rules of the service (see InitTracer), if the TracerProvider is already created.
+*/
+type LogExporter struct {
+	endpoint   string
+	json       bool
+	httpClient *http.Client
+
+	mu       sync.Mutex
+	records  []logger.Record
+	services map[string]logService // by logger.Record.Service
+
+	stop         chan struct{}
+	done         chan struct{}
+	shutdownOnce sync.Once
+}
+
+type logService struct {
+	resource *resource.Resource
+	redactor *Redactor
+}
+
+// setService sets the resource and the redactor (can be nil) of the records of the service (see logger.ServiceOf)
+func (e *LogExporter) setService(service string, res *resource.Resource, redactor *Redactor) {
+	if redactor != nil {
+		res = redactor.redactResource(res)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.services[service] = logService{resource: res, redactor: redactor}
+}
+
+func (e *LogExporter) Export(record logger.Record) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.records) >= logExportMaxRecords {
+		e.records = e.records[1:]
+	}
+	e.records = append(e.records, record)
+}
+
+func (e *LogExporter) Flush(ctx context.Context) error {
+	e.mu.Lock()
+	records := e.records
+	e.records = nil
+	services := make(map[string]logService, len(e.services))
+	for name, service := range e.services {
+		services[name] = service
+	}
+	e.mu.Unlock()
+	if len(records) == 0 {
+		return nil
+	}
+
+	return e.send(ctx, newExportLogsRequest(records, services))
+}
+
+func (e *LogExporter) Shutdown(ctx context.Context) error {
+	e.shutdownOnce.Do(func() {
+		close(e.stop)
+		<-e.done
+	})
+	defer e.httpClient.CloseIdleConnections()
+
+	return e.Flush(ctx)
+}
+
+func (e *LogExporter) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(logExportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-e.stop:
+			return
+		case <-ticker.C:
+			if err := e.Flush(context.Background()); err != nil {
+				otel.Handle(err)
+			}
+		}
+	}
+}
+
+func (e *LogExporter) send(ctx context.Context, request *collogspb.ExportLogsServiceRequest) error {
+	var body []byte
+	var err error
+	contentType := "application/x-protobuf"
+	if e.json {
+		contentType = "application/json"
+		body, err = marshalOtlpJSON(request)
+	} else {
+		body, err = proto.Marshal(request)
+		err = errors.Wrap(err, "unable to marshal OTLP request")
+	}
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "unable to create OTLP request")
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "unable to send OTLP request")
+	}
+	defer resp.Body.Close()               //nolint:errcheck // not important
+	_, _ = io.Copy(io.Discard, resp.Body) //nolint:errcheck // drain
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return errors.WithDetails(ErrLogExport, "status", resp.Status)
+	}
+
+	return nil
+}
+
+/*
+newExportLogsRequest groups the records by service (resource) and logger name (scope).
+The resource is set by setService. If the service isn't in services (the TracerProvider is not created yet),
+only the service name (the logger service and the namespace, for example: frontend.opentracing-example)
+and the namespace are set on the resource.
+*/
+func newExportLogsRequest(records []logger.Record, services map[string]logService) *collogspb.ExportLogsServiceRequest {
+	request := &collogspb.ExportLogsServiceRequest{}
+	resourceLogs := map[string]*logspb.ResourceLogs{}
+	scopeLogs := map[string]*logspb.ScopeLogs{}
+	for r := range records {
+		record := &records[r]
+		service := services[record.Service]
+		resource, has := resourceLogs[record.Service]
+		if !has {
+			resource = &logspb.ResourceLogs{SchemaUrl: semconv.SchemaURL}
+			if service.resource != nil {
+				resource.Resource = &resourcepb.Resource{Attributes: attributesToProto(service.resource.Attributes())}
+				resource.SchemaUrl = service.resource.SchemaURL()
+			} else {
+				resource.Resource = &resourcepb.Resource{Attributes: attributesToProto([]attribute.KeyValue{
+					semconv.ServiceNamespaceKey.String(serviceNamespace),
+					semconv.ServiceNameKey.String(record.Service + "." + serviceNamespace),
+				})}
+			}
+			resourceLogs[record.Service] = resource
+			request.ResourceLogs = append(request.ResourceLogs, resource)
+		}
+		scope, has := scopeLogs[record.Service+"\xff"+record.Logger]
+		if !has {
+			scope = &logspb.ScopeLogs{Scope: &commonpb.InstrumentationScope{Name: record.Logger}}
+			scopeLogs[record.Service+"\xff"+record.Logger] = scope
+			resource.ScopeLogs = append(resource.ScopeLogs, scope)
+		}
+		scope.LogRecords = append(scope.LogRecords, newLogRecord(record, service.redactor))
+	}
+
+	return request
+}
+
+// newLogRecord converts the record, the message and the attributes are redacted, if the redactor is not nil
+func newLogRecord(record *logger.Record, redactor *Redactor) *logspb.LogRecord {
+	attrs := record.Attributes
+	if record.Err != nil {
+		attrs = append(append([]attribute.KeyValue{}, attrs...), logger.KeyError.String(record.Err.Error()))
+	}
+	message := record.Message
+	if redactor != nil {
+		attrs = redactor.RedactAttributes(attrs)
+		message = redactor.RedactString(message)
+	}
+	logRecord := &logspb.LogRecord{
+		TimeUnixNano:         uint64(record.Time.UnixNano()),
+		ObservedTimeUnixNano: uint64(record.Time.UnixNano()),
+		SeverityNumber:       severityNumber(record.Severity),
+		SeverityText:         record.Severity,
+		Body:                 &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: message}},
+		Attributes:           attributesToProto(attrs),
+	}
+	if record.SpanContext.IsValid() {
+		traceID := record.SpanContext.TraceID()
+		spanID := record.SpanContext.SpanID()
+		logRecord.TraceId = traceID[:]
+		logRecord.SpanId = spanID[:]
+		logRecord.Flags = uint32(record.SpanContext.TraceFlags())
+	}
+
+	return logRecord
+}
+
+func severityNumber(severity string) logspb.SeverityNumber {
+	switch severity {
+	case logger.SeverityTrace:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_TRACE
+	case logger.SeverityDebug:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_DEBUG
+	case logger.SeverityError:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_ERROR
+	default:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_INFO
+	}
+}
+
+func attributesToProto(attrs []attribute.KeyValue) []*commonpb.KeyValue {
+	protoAttrs := make([]*commonpb.KeyValue, 0, len(attrs))
+	for _, attr := range attrs {
+		protoAttrs = append(protoAttrs, &commonpb.KeyValue{Key: string(attr.Key), Value: attributeValueToProto(attr.Value)})
+	}
+
+	return protoAttrs
+}
+
+func attributeValueToProto(value attribute.Value) *commonpb.AnyValue {
+	switch value.Type() { //nolint:exhaustive // the other types are strings
+	case attribute.BOOL:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: value.AsBool()}}
+	case attribute.INT64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: value.AsInt64()}}
+	case attribute.FLOAT64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: value.AsFloat64()}}
+	case attribute.STRINGSLICE:
+		values := []*commonpb.AnyValue{}
+		for _, item := range value.AsStringSlice() {
+			values = append(values, &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: item}})
+		}
+
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_ArrayValue{ArrayValue: &commonpb.ArrayValue{Values: values}}}
+	default:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value.Emit()}}
+	}
+}
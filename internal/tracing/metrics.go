@@ -0,0 +1,187 @@
+package tracing
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/go-chi/chi/v5"
+	chi_middleware "github.com/go-chi/chi/v5/middleware"
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/attribute"
+	otelprometheus "go.opentelemetry.io/otel/exporters/prometheus"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/global"
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.opentelemetry.io/otel/metric/instrument/syncfloat64"
+	"go.opentelemetry.io/otel/metric/instrument/syncint64"
+	"go.opentelemetry.io/otel/metric/unit"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const MetricsPath = "/metrics"
+
+/*
+InitMeter creates the MeterProvider of the service and sets it as the global MeterProvider.
+The metrics are exported to the returned Prometheus registry, see MetricsHandler.
+Every service has its own Prometheus registry, so more services can run in the same process (tests).
+*/
+func InitMeter(service string, instance string) (*sdkmetric.MeterProvider, *prometheus.Registry, error) {
+	registry := prometheus.NewRegistry()
+	exporter, err := otelprometheus.New(otelprometheus.WithRegisterer(registry))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "unable to create Prometheus exporter")
+	}
+	mp := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(exporter),
+		sdkmetric.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceNamespaceKey.String("opentracing-example"),
+			semconv.ServiceNameKey.String(service),
+			semconv.ServiceInstanceIDKey.String(instance),
+		)),
+	)
+	global.SetMeterProvider(mp)
+
+	return mp, registry, nil
+}
+
+// MetricsHandler serves the metrics of the registry in Prometheus text or OpenMetrics (with exemplars) format
+func MetricsHandler(registry *prometheus.Registry, log logr.Logger) http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{
+		ErrorLog:          &promLogger{log: log},
+		EnableOpenMetrics: true,
+	})
+}
+
+type promLogger struct {
+	log logr.Logger
+}
+
+func (l *promLogger) Println(v ...interface{}) {
+	l.log.Info("Prometheus handler", "message", v)
+}
+
+/*
+HTTPMetrics records the RED (rate, errors, duration) metrics of the incoming (chi middleware)
+and outgoing (http.RoundTripper) requests.
+*/
+type HTTPMetrics struct {
+	serverRequests syncint64.Counter
+	serverErrors   syncint64.Counter
+	serverDuration *ExemplarHistogram
+	clientRequests syncint64.Counter
+	clientErrors   syncint64.Counter
+	clientDuration syncfloat64.Histogram
+}
+
+/*
+NewHTTPMetrics creates the instruments by the meter. The server duration histogram has exemplars,
+so it's registered directly in the Prometheus registry, see ExemplarHistogram.
+*/
+func NewHTTPMetrics(meter metric.Meter, registerer prometheus.Registerer) (*HTTPMetrics, error) {
+	m := &HTTPMetrics{
+		serverDuration: NewExemplarHistogram("http_server_duration_milliseconds", "Duration of the incoming requests",
+			DurationBuckets, "http_method", "http_route", "http_status_code"),
+	}
+	if err := registerer.Register(m.serverDuration); err != nil {
+		return nil, errors.Wrap(err, "unable to register metric")
+	}
+	var err error
+	if m.serverRequests, err = meter.SyncInt64().Counter("http.server.request.count",
+		instrument.WithDescription("Number of the incoming requests")); err != nil {
+		return nil, errors.Wrap(err, "unable to create metric")
+	}
+	if m.serverErrors, err = meter.SyncInt64().Counter("http.server.error.count",
+		instrument.WithDescription("Number of the incoming requests with 5xx response")); err != nil {
+		return nil, errors.Wrap(err, "unable to create metric")
+	}
+	if m.clientRequests, err = meter.SyncInt64().Counter("http.client.request.count",
+		instrument.WithDescription("Number of the outgoing requests")); err != nil {
+		return nil, errors.Wrap(err, "unable to create metric")
+	}
+	if m.clientErrors, err = meter.SyncInt64().Counter("http.client.error.count",
+		instrument.WithDescription("Number of the outgoing requests with transport error or 5xx response")); err != nil {
+		return nil, errors.Wrap(err, "unable to create metric")
+	}
+	if m.clientDuration, err = meter.SyncFloat64().Histogram("http.client.duration",
+		instrument.WithDescription("Duration of the outgoing requests"), instrument.WithUnit(unit.Milliseconds)); err != nil {
+		return nil, errors.Wrap(err, "unable to create metric")
+	}
+
+	return m, nil
+}
+
+/*
+Middleware records the metrics of the incoming requests by method, route and status code.
+It must be registered after the tracer middleware, so the server span is the exemplar of the duration.
+*/
+func (m *HTTPMetrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := chi_middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		route := r.URL.Path
+		if routeContext := chi.RouteContext(r.Context()); routeContext != nil && routeContext.RoutePattern() != "" {
+			route = routeContext.RoutePattern()
+		}
+		attrs := []attribute.KeyValue{
+			semconv.HTTPMethodKey.String(r.Method),
+			semconv.HTTPRouteKey.String(route),
+			semconv.HTTPStatusCodeKey.Int(status),
+		}
+		ctx := r.Context()
+		m.serverRequests.Add(ctx, 1, attrs...)
+		if status >= http.StatusInternalServerError {
+			m.serverErrors.Add(ctx, 1, attrs...)
+		}
+		m.serverDuration.Observe(durationMilliseconds(time.Since(start)), trace.SpanContextFromContext(ctx),
+			r.Method, route, strconv.Itoa(status))
+	})
+}
+
+/*
+Transport records the metrics of the outgoing requests by method and status code.
+The peer host name is not a label, because the targets of /proxy are set by the caller (unbounded cardinality).
+*/
+func (m *HTTPMetrics) Transport(next http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		start := time.Now()
+		resp, err := next.RoundTrip(req)
+
+		attrs := []attribute.KeyValue{
+			semconv.HTTPMethodKey.String(req.Method),
+		}
+		if resp != nil {
+			attrs = append(attrs, semconv.HTTPStatusCodeKey.Int(resp.StatusCode))
+		}
+		ctx := req.Context()
+		m.clientRequests.Add(ctx, 1, attrs...)
+		if err != nil || resp.StatusCode >= http.StatusInternalServerError {
+			m.clientErrors.Add(ctx, 1, attrs...)
+		}
+		m.clientDuration.Record(ctx, durationMilliseconds(time.Since(start)), attrs...)
+
+		return resp, err //nolint:wrapcheck // transparent wrapper
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func durationMilliseconds(duration time.Duration) float64 {
+	return float64(duration) / float64(time.Millisecond)
+}
@@ -0,0 +1,89 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/opentracing/opentracing-go"
+	otbridge "go.opentelemetry.io/otel/bridge/opentracing"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const OpenTracingTracerName = "github.com/pgillich/opentracing-example/opentracing"
+
+/*
+WithOpenTracingBridge installs the OpenTelemetry-OpenTracing bridge as the global OpenTracing tracer,
+so the code instrumented by opentracing-go joins the same traces. The propagator is used by the
+Inject and Extract methods of the bridge. The bridge is uninstalled by TracerProvider.Shutdown.
+*/
+func WithOpenTracingBridge(propagator propagation.TextMapPropagator) TracerOption {
+	return func(options *tracerOptions) {
+		options.openTracingPropagator = propagator
+	}
+}
+
+/*
+setOpenTracingBridge installs the bridge as the global OpenTracing tracer. The returned cleanup
+restores the no-op global tracer, if the bridge is still installed.
+*/
+func setOpenTracingBridge(tp *sdktrace.TracerProvider, propagator propagation.TextMapPropagator, log logr.Logger) (*otbridge.BridgeTracer, func()) {
+	bridgeTracer, _ := otbridge.NewTracerPair(tp.Tracer(OpenTracingTracerName, trace.WithInstrumentationVersion(SemVersion())))
+	bridgeTracer.SetTextMapPropagator(propagator)
+	bridgeTracer.SetWarningHandler(func(msg string) {
+		log.V(1).Info("OpenTracing bridge", "warning", strings.TrimSpace(msg))
+	})
+	opentracing.SetGlobalTracer(bridgeTracer)
+
+	return bridgeTracer, func() {
+		if opentracing.GlobalTracer() == opentracing.Tracer(bridgeTracer) {
+			opentracing.SetGlobalTracer(opentracing.NoopTracer{})
+		}
+	}
+}
+
+/*
+TracerProvider is the TracerProvider built by InitTracer. If the OpenTracing bridge is installed,
+the tracers are wrapped by the bridge, so the OpenTracing spans started in the context of an OpenTelemetry span
+are its children, and Shutdown uninstalls the bridge.
+*/
+type TracerProvider struct {
+	*sdktrace.TracerProvider
+
+	bridgeTracer  *otbridge.BridgeTracer
+	bridgeCleanup func()
+}
+
+// Tracer returns a named tracer, wrapped by the OpenTracing bridge, if it's installed
+func (tp *TracerProvider) Tracer(name string, opts ...trace.TracerOption) trace.Tracer {
+	tracer := tp.TracerProvider.Tracer(name, opts...)
+	if tp.bridgeTracer == nil {
+		return tracer
+	}
+
+	// the wrapper provider of otbridge.NewTracerPair has a single tracer, so the named tracers are wrapped one by one
+	return otbridge.NewWrapperTracer(tp.bridgeTracer, tracer)
+}
+
+// Shutdown uninstalls the OpenTracing bridge and shuts down the TracerProvider
+func (tp *TracerProvider) Shutdown(ctx context.Context) error {
+	if tp.bridgeCleanup != nil {
+		tp.bridgeCleanup()
+	}
+
+	return tp.TracerProvider.Shutdown(ctx) //nolint:wrapcheck // transparent wrapper
+}
+
+/*
+ContextWithOpenTracingSpan sets the OpenTelemetry span as the active OpenTracing span of the context,
+if the global OpenTracing tracer is the bridge, so opentracing.StartSpanFromContext creates a child span.
+*/
+func ContextWithOpenTracingSpan(ctx context.Context, span trace.Span) context.Context {
+	if bridgeTracer, is := opentracing.GlobalTracer().(*otbridge.BridgeTracer); is {
+		return bridgeTracer.ContextWithBridgeSpan(ctx, span)
+	}
+
+	return ctx
+}
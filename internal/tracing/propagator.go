@@ -0,0 +1,76 @@
+package tracing
+
+import (
+	"os"
+	"strings"
+
+	"emperror.dev/errors"
+	"go.opentelemetry.io/contrib/propagators/aws/xray"
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/contrib/propagators/jaeger"
+	"go.opentelemetry.io/contrib/propagators/ot"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+const (
+	PropagatorTraceContext = "tracecontext"
+	PropagatorBaggage      = "baggage"
+	PropagatorB3           = "b3"
+	PropagatorB3Multi      = "b3multi"
+	PropagatorJaeger       = "jaeger"
+	PropagatorXray         = "xray"
+	PropagatorOtTrace      = "ottrace"
+	PropagatorNone         = "none"
+
+	EnvOtelPropagators = "OTEL_PROPAGATORS"
+)
+
+var ErrUnknownPropagator = errors.NewPlain("unknown propagator")
+
+/*
+NewPropagator creates a composite propagator by the OTEL_PROPAGATORS names:
+tracecontext, baggage, b3, b3multi, jaeger, xray, ottrace, none.
+The names can be comma separated, too. If names is empty, the OTEL_PROPAGATORS environment variable is used,
+the default is tracecontext,baggage.
+
+All propagators extract the incoming headers (the later wins), and inject the outgoing headers.
+*/
+func NewPropagator(names []string) (propagation.TextMapPropagator, error) {
+	if len(names) == 0 {
+		if env := os.Getenv(EnvOtelPropagators); env != "" {
+			names = []string{env}
+		} else {
+			names = []string{PropagatorTraceContext, PropagatorBaggage}
+		}
+	}
+
+	propagators := []propagation.TextMapPropagator{}
+	for _, item := range names {
+		for _, name := range strings.Split(item, ",") {
+			switch strings.ToLower(strings.TrimSpace(name)) {
+			case "":
+				continue
+			case PropagatorTraceContext:
+				propagators = append(propagators, propagation.TraceContext{})
+			case PropagatorBaggage:
+				propagators = append(propagators, propagation.Baggage{})
+			case PropagatorB3:
+				propagators = append(propagators, b3.New(b3.WithInjectEncoding(b3.B3SingleHeader)))
+			case PropagatorB3Multi:
+				propagators = append(propagators, b3.New(b3.WithInjectEncoding(b3.B3MultipleHeader)))
+			case PropagatorJaeger:
+				propagators = append(propagators, jaeger.Jaeger{})
+			case PropagatorXray:
+				propagators = append(propagators, xray.Propagator{})
+			case PropagatorOtTrace:
+				propagators = append(propagators, ot.OT{})
+			case PropagatorNone:
+				return propagation.NewCompositeTextMapPropagator(), nil
+			default:
+				return nil, errors.WithDetails(ErrUnknownPropagator, "propagator", name)
+			}
+		}
+	}
+
+	return propagation.NewCompositeTextMapPropagator(propagators...), nil
+}
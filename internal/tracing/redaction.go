@@ -0,0 +1,266 @@
+package tracing
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"sync"
+
+	"emperror.dev/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	RedactedValue = "[REDACTED]"
+
+	headerAttributePrefixRequest  = "http.request.header."
+	headerAttributePrefixResponse = "http.response.header."
+)
+
+// RedactionConfig is the rule set of Redactor
+type RedactionConfig struct {
+	// QueryParams are the names of the query parameters to be masked in all string values, * masks all
+	QueryParams []string
+	// Headers are the names of the HTTP headers, the http.request.header.* and http.response.header.* attributes are masked
+	Headers []string
+	// AttributeKeys are regexps of the attribute (and tracestate) keys to be masked
+	AttributeKeys []string
+	// AllowedKeys are regexps of the attribute keys, which are not masked. If empty, all keys are allowed
+	AllowedKeys []string
+}
+
+func (c RedactionConfig) IsEnabled() bool {
+	return len(c.QueryParams)+len(c.Headers)+len(c.AttributeKeys)+len(c.AllowedKeys) > 0
+}
+
+// Redactor masks the sensitive values of spans
+type Redactor struct {
+	allQueryParams bool
+	queryParams    map[string]bool
+	headers        map[string]bool
+	attributeKeys  []*regexp.Regexp
+	allowedKeys    []*regexp.Regexp
+
+	resources sync.Map // *resource.Resource -> *resource.Resource
+}
+
+// queryParamRe matches the query parameters (in URLs and command lines)
+var queryParamRe = regexp.MustCompile(`([?&;])([^=&#;\s?]+)=([^&#;\s]*)`)
+
+func NewRedactor(config RedactionConfig) (*Redactor, error) {
+	r := &Redactor{
+		queryParams: map[string]bool{},
+		headers:     map[string]bool{},
+	}
+	for _, name := range config.QueryParams {
+		if name == "*" {
+			r.allQueryParams = true
+		} else if name != "" {
+			r.queryParams[name] = true
+		}
+	}
+	for _, name := range config.Headers {
+		if name != "" {
+			r.headers[strings.ToLower(name)] = true
+		}
+	}
+	var err error
+	if r.attributeKeys, err = compileRegexps(config.AttributeKeys); err != nil {
+		return nil, err
+	}
+	if r.allowedKeys, err = compileRegexps(config.AllowedKeys); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func compileRegexps(exprs []string) ([]*regexp.Regexp, error) {
+	regexps := []*regexp.Regexp{}
+	for _, expr := range exprs {
+		if expr == "" {
+			continue
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, errors.WrapWithDetails(err, "invalid redaction regexp", "regexp", expr)
+		}
+		regexps = append(regexps, re)
+	}
+
+	return regexps, nil
+}
+
+// RedactString masks the values of the configured query parameters
+func (r *Redactor) RedactString(value string) string {
+	if !r.allQueryParams && len(r.queryParams) == 0 {
+		return value
+	}
+
+	return queryParamRe.ReplaceAllStringFunc(value, func(param string) string {
+		match := queryParamRe.FindStringSubmatch(param)
+		if r.allQueryParams || r.queryParams[match[2]] {
+			return match[1] + match[2] + "=" + RedactedValue
+		}
+
+		return param
+	})
+}
+
+func (r *Redactor) isMaskedKey(key string) bool {
+	lowerKey := strings.ToLower(key)
+	for _, prefix := range []string{headerAttributePrefixRequest, headerAttributePrefixResponse} {
+		if strings.HasPrefix(lowerKey, prefix) && r.headers[strings.ReplaceAll(lowerKey[len(prefix):], "_", "-")] {
+			return true
+		}
+	}
+	for _, re := range r.attributeKeys {
+		if re.MatchString(key) {
+			return true
+		}
+	}
+	if len(r.allowedKeys) == 0 {
+		return false
+	}
+	for _, re := range r.allowedKeys {
+		if re.MatchString(key) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// RedactAttributes returns the attributes with masked values
+func (r *Redactor) RedactAttributes(attrs []attribute.KeyValue) []attribute.KeyValue {
+	if len(attrs) == 0 {
+		return attrs
+	}
+	redacted := make([]attribute.KeyValue, len(attrs))
+	for i, attr := range attrs {
+		switch {
+		case r.isMaskedKey(string(attr.Key)):
+			redacted[i] = attr.Key.String(RedactedValue)
+		case attr.Value.Type() == attribute.STRING:
+			redacted[i] = attr.Key.String(r.RedactString(attr.Value.AsString()))
+		case attr.Value.Type() == attribute.STRINGSLICE:
+			values := attr.Value.AsStringSlice()
+			for v := range values {
+				values[v] = r.RedactString(values[v])
+			}
+			redacted[i] = attr.Key.StringSlice(values)
+		default:
+			redacted[i] = attr
+		}
+	}
+
+	return redacted
+}
+
+func (r *Redactor) redactResource(res *resource.Resource) *resource.Resource {
+	if res == nil {
+		return nil
+	}
+	if redacted, has := r.resources.Load(res); has {
+		return redacted.(*resource.Resource) //nolint:forcetypeassert // only *resource.Resource is stored
+	}
+	redacted := resource.NewWithAttributes(res.SchemaURL(), r.RedactAttributes(res.Attributes())...)
+	r.resources.Store(res, redacted)
+
+	return redacted
+}
+
+func (r *Redactor) redactTraceState(traceState trace.TraceState) trace.TraceState {
+	if traceState.Len() == 0 {
+		return traceState
+	}
+	members := strings.Split(traceState.String(), ",")
+	for m, member := range members {
+		if key, value, found := strings.Cut(member, "="); found {
+			if r.isMaskedKey(key) {
+				value = RedactedValue
+			} else {
+				value = r.RedactString(value)
+			}
+			members[m] = key + "=" + value
+		}
+	}
+	redacted, err := trace.ParseTraceState(strings.Join(members, ","))
+	if err != nil {
+		return trace.TraceState{}
+	}
+
+	return redacted
+}
+
+type redactedSpan struct {
+	sdktrace.ReadOnlySpan
+	redactor *Redactor
+}
+
+func (s *redactedSpan) Name() string {
+	return s.redactor.RedactString(s.ReadOnlySpan.Name())
+}
+
+func (s *redactedSpan) SpanContext() trace.SpanContext {
+	spanContext := s.ReadOnlySpan.SpanContext()
+
+	return spanContext.WithTraceState(s.redactor.redactTraceState(spanContext.TraceState()))
+}
+
+func (s *redactedSpan) Attributes() []attribute.KeyValue {
+	return s.redactor.RedactAttributes(s.ReadOnlySpan.Attributes())
+}
+
+func (s *redactedSpan) Events() []sdktrace.Event {
+	events := s.ReadOnlySpan.Events()
+	redacted := make([]sdktrace.Event, len(events))
+	for e, event := range events {
+		redacted[e] = event
+		redacted[e].Name = s.redactor.RedactString(event.Name)
+		redacted[e].Attributes = s.redactor.RedactAttributes(event.Attributes)
+	}
+
+	return redacted
+}
+
+func (s *redactedSpan) Resource() *resource.Resource {
+	return s.redactor.redactResource(s.ReadOnlySpan.Resource())
+}
+
+/*
+RedactionProcessor masks the sensitive values (query parameters, header values, attributes) of the ended spans
+before passing them to the next span processor (for example: the exporter batcher).
+The span name, attributes, event names and attributes, resource attributes and tracestate values are redacted.
+The propagated headers (traceparent, tracestate, baggage) of the outgoing requests are not modified.
+*/
+type RedactionProcessor struct {
+	next     sdktrace.SpanProcessor
+	redactor *Redactor
+}
+
+func NewRedactionProcessor(next sdktrace.SpanProcessor, redactor *Redactor) *RedactionProcessor {
+	return &RedactionProcessor{
+		next:     next,
+		redactor: redactor,
+	}
+}
+
+func (p *RedactionProcessor) OnStart(parent context.Context, span sdktrace.ReadWriteSpan) {
+	p.next.OnStart(parent, span)
+}
+
+func (p *RedactionProcessor) OnEnd(span sdktrace.ReadOnlySpan) {
+	p.next.OnEnd(&redactedSpan{ReadOnlySpan: span, redactor: p.redactor})
+}
+
+func (p *RedactionProcessor) Shutdown(ctx context.Context) error {
+	return p.next.Shutdown(ctx) //nolint:wrapcheck // transparent wrapper
+}
+
+func (p *RedactionProcessor) ForceFlush(ctx context.Context) error {
+	return p.next.ForceFlush(ctx) //nolint:wrapcheck // transparent wrapper
+}
@@ -0,0 +1,122 @@
+package tracing
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+)
+
+const (
+	// EnvK8sPodInfoDir is the directory of the downward API volume, default is DefaultK8sPodInfoDir
+	EnvK8sPodInfoDir     = "K8S_PODINFO_DIR"
+	DefaultK8sPodInfoDir = "/etc/podinfo"
+
+	k8sNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+)
+
+var ErrInvalidResourceAttribute = errors.NewPlain("invalid resource attribute")
+
+/*
+k8sDetector detects the Kubernetes pod metadata. The values are read from the downward API
+environment variables (K8S_POD_NAME, K8S_POD_UID, K8S_NAMESPACE_NAME, K8S_NODE_NAME) or
+from the files of the downward API volume (name, uid, namespace, nodename in K8S_PODINFO_DIR).
+The namespace falls back to the namespace of the service account.
+*/
+type k8sDetector struct{}
+
+func (k8sDetector) Detect(ctx context.Context) (*resource.Resource, error) {
+	podInfoDir := os.Getenv(EnvK8sPodInfoDir)
+	if podInfoDir == "" {
+		podInfoDir = DefaultK8sPodInfoDir
+	}
+	sources := []struct {
+		key   attribute.Key
+		env   string
+		files []string
+	}{
+		{semconv.K8SPodNameKey, "K8S_POD_NAME", []string{filepath.Join(podInfoDir, "name")}},
+		{semconv.K8SPodUIDKey, "K8S_POD_UID", []string{filepath.Join(podInfoDir, "uid")}},
+		{semconv.K8SNamespaceNameKey, "K8S_NAMESPACE_NAME", []string{filepath.Join(podInfoDir, "namespace"), k8sNamespaceFile}},
+		{semconv.K8SNodeNameKey, "K8S_NODE_NAME", []string{filepath.Join(podInfoDir, "nodename")}},
+	}
+
+	attrs := []attribute.KeyValue{}
+	for _, source := range sources {
+		if value := k8sValue(source.env, source.files); value != "" {
+			attrs = append(attrs, source.key.String(value))
+		}
+	}
+	if len(attrs) == 0 {
+		return resource.Empty(), nil
+	}
+
+	return resource.NewWithAttributes(semconv.SchemaURL, attrs...), nil
+}
+
+func k8sValue(env string, files []string) string {
+	if value := strings.TrimSpace(os.Getenv(env)); value != "" {
+		return value
+	}
+	for _, file := range files {
+		if content, err := os.ReadFile(file); err == nil { //nolint:gosec // well-known files
+			if value := strings.TrimSpace(string(content)); value != "" {
+				return value
+			}
+		}
+	}
+
+	return ""
+}
+
+// ParseResourceAttributes parses the key=value pairs
+func ParseResourceAttributes(pairs []string) ([]attribute.KeyValue, error) {
+	attrs := make([]attribute.KeyValue, 0, len(pairs))
+	for _, pair := range pairs {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		key, value, found := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !found || key == "" {
+			return nil, errors.WithDetails(ErrInvalidResourceAttribute, "attribute", pair)
+		}
+		attrs = append(attrs, attribute.String(key, strings.TrimSpace(value)))
+	}
+
+	return attrs, nil
+}
+
+/*
+NewResource detects the resource of the process. The attributes are merged in this order (the later wins):
+service attributes, host, OS, process, container, Kubernetes, OTEL_RESOURCE_ATTRIBUTES and extraAttrs.
+The detection errors are logged, the detected attributes are used.
+*/
+func NewResource(ctx context.Context, serviceAttrs []attribute.KeyValue, extraAttrs []attribute.KeyValue, log logr.Logger) *resource.Resource {
+	res, err := resource.New(ctx,
+		resource.WithSchemaURL(semconv.SchemaURL),
+		resource.WithAttributes(serviceAttrs...),
+		resource.WithTelemetrySDK(),
+		resource.WithHost(),
+		resource.WithOS(),
+		resource.WithProcess(),
+		resource.WithContainer(),
+		resource.WithDetectors(k8sDetector{}),
+		resource.WithFromEnv(),
+		resource.WithAttributes(extraAttrs...),
+	)
+	if err != nil {
+		log.Error(err, "unable to detect all resource attributes")
+	}
+	if res == nil || res.Len() == 0 {
+		res = resource.NewWithAttributes(semconv.SchemaURL, append(serviceAttrs, extraAttrs...)...)
+	}
+
+	return res
+}
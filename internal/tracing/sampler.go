@@ -0,0 +1,227 @@
+package tracing
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	SamplerAlwaysOn                = "always_on"
+	SamplerAlwaysOff               = "always_off"
+	SamplerTraceIDRatio            = "traceidratio"
+	SamplerRateLimit               = "ratelimit"
+	SamplerParentBasedAlwaysOn     = "parentbased_always_on"
+	SamplerParentBasedAlwaysOff    = "parentbased_always_off"
+	SamplerParentBasedTraceIDRatio = "parentbased_traceidratio"
+	SamplerParentBasedRateLimit    = "parentbased_ratelimit"
+
+	samplerRuleAny = "*"
+)
+
+var ErrInvalidSampler = errors.NewPlain("invalid sampler")
+
+/*
+NewSampler creates the sampler by the spec (OTEL_TRACES_SAMPLER names, the argument is after a colon):
+
+	always_on, always (alias), parentbased_always_on
+	always_off, never (alias), parentbased_always_off
+	traceidratio:0.1, parentbased_traceidratio:0.1
+	ratelimit:10, parentbased_ratelimit:10 (spans per second)
+
+If rules are set, the spans are sampled by the first matching rule, otherwise by spec.
+A rule is "METHOD ROUTE=SPEC", where the METHOD and ROUTE (chi route pattern) can be *, for example:
+
+	GET /ping=traceidratio:0.01
+	* /proxy=always_on
+*/
+func NewSampler(spec string, rules []string) (sdktrace.Sampler, error) {
+	sampler, err := parseSampler(spec)
+	if err != nil {
+		return nil, err
+	}
+	if len(rules) == 0 {
+		return sampler, nil
+	}
+
+	ruleSampler := &RuleSampler{fallback: sampler}
+	for _, rule := range rules {
+		if strings.TrimSpace(rule) == "" {
+			continue
+		}
+		key, ruleSpec, found := strings.Cut(rule, "=")
+		fields := strings.Fields(key)
+		if !found || len(fields) != 2 { //nolint:gomnd // METHOD ROUTE
+			return nil, errors.WithDetails(ErrInvalidSampler, "rule", rule)
+		}
+		sampler, err := parseSampler(ruleSpec) //nolint:govet // err shadow
+		if err != nil {
+			return nil, errors.WithDetails(err, "rule", rule)
+		}
+		ruleSampler.rules = append(ruleSampler.rules, samplerRule{
+			method:  strings.ToUpper(fields[0]),
+			route:   fields[1],
+			sampler: sampler,
+		})
+	}
+
+	return ruleSampler, nil
+}
+
+func parseSampler(spec string) (sdktrace.Sampler, error) {
+	name, arg, hasArg := strings.Cut(strings.TrimSpace(spec), ":")
+	name = strings.ToLower(name)
+	switch name {
+	case SamplerAlwaysOn, "always", "":
+		return sdktrace.AlwaysSample(), nil
+	case SamplerAlwaysOff, "never":
+		return sdktrace.NeverSample(), nil
+	case SamplerParentBasedAlwaysOn:
+		return sdktrace.ParentBased(sdktrace.AlwaysSample()), nil
+	case SamplerParentBasedAlwaysOff:
+		return sdktrace.ParentBased(sdktrace.NeverSample()), nil
+	case SamplerTraceIDRatio, SamplerParentBasedTraceIDRatio:
+		ratio := 1.0
+		if hasArg {
+			var err error
+			if ratio, err = strconv.ParseFloat(arg, 64); err != nil || ratio < 0 || ratio > 1 {
+				return nil, errors.WithDetails(ErrInvalidSampler, "sampler", spec)
+			}
+		}
+		if name == SamplerTraceIDRatio {
+			return sdktrace.TraceIDRatioBased(ratio), nil
+		}
+
+		return sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio)), nil
+	case SamplerRateLimit, SamplerParentBasedRateLimit:
+		perSecond, err := strconv.ParseFloat(arg, 64)
+		if !hasArg || err != nil || perSecond < 0 {
+			return nil, errors.WithDetails(ErrInvalidSampler, "sampler", spec)
+		}
+		if name == SamplerRateLimit {
+			return NewRateLimitingSampler(perSecond), nil
+		}
+
+		return sdktrace.ParentBased(NewRateLimitingSampler(perSecond)), nil
+	default:
+		return nil, errors.WithDetails(ErrInvalidSampler, "sampler", spec)
+	}
+}
+
+/*
+RateLimitingSampler samples at most perSecond traces in a second (token bucket).
+The bucket size is max(perSecond, 1), so short bursts are allowed.
+*/
+type RateLimitingSampler struct {
+	perSecond float64
+	maxTokens float64
+
+	mu       sync.Mutex
+	tokens   float64
+	lastTime time.Time
+}
+
+func NewRateLimitingSampler(perSecond float64) *RateLimitingSampler {
+	maxTokens := perSecond
+	if maxTokens < 1 {
+		maxTokens = 1
+	}
+
+	return &RateLimitingSampler{
+		perSecond: perSecond,
+		maxTokens: maxTokens,
+		tokens:    maxTokens,
+		lastTime:  time.Now(),
+	}
+}
+
+func (s *RateLimitingSampler) ShouldSample(parameters sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	psc := trace.SpanContextFromContext(parameters.ParentContext)
+	result := sdktrace.SamplingResult{
+		Decision:   sdktrace.Drop,
+		Tracestate: psc.TraceState(),
+	}
+	if s.takeToken() {
+		result.Decision = sdktrace.RecordAndSample
+	}
+
+	return result
+}
+
+func (s *RateLimitingSampler) takeToken() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.tokens += now.Sub(s.lastTime).Seconds() * s.perSecond
+	if s.tokens > s.maxTokens {
+		s.tokens = s.maxTokens
+	}
+	s.lastTime = now
+	if s.tokens < 1 {
+		return false
+	}
+	s.tokens--
+
+	return true
+}
+
+func (s *RateLimitingSampler) Description() string {
+	return fmt.Sprintf("RateLimitingSampler{%g}", s.perSecond)
+}
+
+type samplerRule struct {
+	method  string
+	route   string
+	sampler sdktrace.Sampler
+}
+
+/*
+RuleSampler selects the sampler by the HTTP method and route (chi route pattern) attributes of the span.
+Spans without matching rule (for example: outgoing HTTP requests) are sampled by the fallback sampler.
+*/
+type RuleSampler struct {
+	rules    []samplerRule
+	fallback sdktrace.Sampler
+}
+
+func (s *RuleSampler) ShouldSample(parameters sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	method, route := "", ""
+	for _, attr := range parameters.Attributes {
+		switch attr.Key {
+		case semconv.HTTPMethodKey:
+			method = attr.Value.AsString()
+		case semconv.HTTPRouteKey:
+			route = attr.Value.AsString()
+		}
+	}
+	if route != "" {
+		for _, rule := range s.rules {
+			if rule.matches(method, route) {
+				return rule.sampler.ShouldSample(parameters)
+			}
+		}
+	}
+
+	return s.fallback.ShouldSample(parameters)
+}
+
+func (r samplerRule) matches(method string, route string) bool {
+	return (r.method == samplerRuleAny || r.method == method) && (r.route == samplerRuleAny || r.route == route)
+}
+
+func (s *RuleSampler) Description() string {
+	rules := make([]string, 0, len(s.rules))
+	for _, rule := range s.rules {
+		rules = append(rules, rule.method+" "+rule.route+"="+rule.sampler.Description())
+	}
+
+	return fmt.Sprintf("RuleSampler{%s,fallback:%s}", strings.Join(rules, ","), s.fallback.Description())
+}
@@ -0,0 +1,172 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	HeaderTraceResponse = "traceresponse"
+	HeaderServerTiming  = "Server-Timing"
+
+	// TraceURLTraceID is the placeholder of the trace ID in the trace UI link template
+	TraceURLTraceID = "{traceID}"
+
+	serverTimingTotal       = "total"
+	serverTimingMaxChildren = 10
+)
+
+type spanTiming struct {
+	name     string
+	duration time.Duration
+}
+
+// timingRecorder collects the timings of the ended direct child spans of a server span
+type timingRecorder struct {
+	spanID   trace.SpanID
+	start    time.Time
+	mu       sync.Mutex
+	children []spanTiming
+}
+
+type timingRecorderKey struct{}
+
+// contextWithTimingRecorder sets the recorder of the server span, the child spans started by the context are recorded
+func contextWithTimingRecorder(ctx context.Context, recorder *timingRecorder) context.Context {
+	return context.WithValue(ctx, timingRecorderKey{}, recorder)
+}
+
+func (r *timingRecorder) add(timing spanTiming) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.children) < serverTimingMaxChildren {
+		r.children = append(r.children, timing)
+	}
+}
+
+/*
+serverTimingProcessor records the ended direct child spans of the server spans to the recorders of the
+contexts (see contextWithTimingRecorder), so the Server-Timing header can be written before the server span ends.
+Each TracerProvider has its own processor.
+*/
+type serverTimingProcessor struct {
+	mu        sync.Mutex
+	recorders map[trace.SpanID]*timingRecorder // by the span ID of the in-flight child span
+}
+
+func newServerTimingProcessor() *serverTimingProcessor {
+	return &serverTimingProcessor{recorders: map[trace.SpanID]*timingRecorder{}}
+}
+
+func (p *serverTimingProcessor) OnStart(parent context.Context, span sdktrace.ReadWriteSpan) {
+	recorder, has := parent.Value(timingRecorderKey{}).(*timingRecorder)
+	if !has || span.Parent().SpanID() != recorder.spanID {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.recorders[span.SpanContext().SpanID()] = recorder
+}
+
+func (p *serverTimingProcessor) OnEnd(span sdktrace.ReadOnlySpan) {
+	p.mu.Lock()
+	recorder, has := p.recorders[span.SpanContext().SpanID()]
+	delete(p.recorders, span.SpanContext().SpanID())
+	p.mu.Unlock()
+	if has {
+		recorder.add(spanTiming{name: span.Name(), duration: span.EndTime().Sub(span.StartTime())})
+	}
+}
+
+func (p *serverTimingProcessor) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+func (p *serverTimingProcessor) ForceFlush(ctx context.Context) error {
+	return nil
+}
+
+// TraceResponse formats the W3C traceresponse header value
+func TraceResponse(spanContext trace.SpanContext) string {
+	return fmt.Sprintf("00-%s-%s-%s", spanContext.TraceID(), spanContext.SpanID(), spanContext.TraceFlags())
+}
+
+// ParseTraceResponse returns the trace ID and span ID of the traceresponse header value
+func ParseTraceResponse(value string) (trace.TraceID, trace.SpanID, bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) != 4 { //nolint:gomnd // version-traceid-spanid-flags
+		return trace.TraceID{}, trace.SpanID{}, false
+	}
+	traceID, err := trace.TraceIDFromHex(parts[1])
+	if err != nil {
+		return trace.TraceID{}, trace.SpanID{}, false
+	}
+	spanID, err := trace.SpanIDFromHex(parts[2])
+	if err != nil {
+		return trace.TraceID{}, trace.SpanID{}, false
+	}
+
+	return traceID, spanID, true
+}
+
+/*
+serverTiming formats the Server-Timing header value: the total server time and the timings
+of the ended child spans, for example:
+
+	total;dur=12.3, span1;dur=10.1;desc="HTTP GET"
+*/
+func (r *timingRecorder) serverTiming(now time.Time) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	metrics := []string{serverTimingTotal + ";dur=" + formatTimingDuration(now.Sub(r.start))}
+	for c, child := range r.children {
+		metrics = append(metrics, "span"+strconv.Itoa(c+1)+";dur="+formatTimingDuration(child.duration)+
+			";desc="+quoteString(child.name))
+	}
+
+	return strings.Join(metrics, ", ")
+}
+
+// quoteString formats a quoted-string (RFC 9110), only the double quote and the backslash are escaped
+func quoteString(value string) string {
+	var quoted strings.Builder
+	quoted.WriteByte('"')
+	for _, r := range value {
+		switch {
+		case r == '"' || r == '\\':
+			quoted.WriteByte('\\')
+			quoted.WriteRune(r)
+		case (r < ' ' && r != '\t') || r == 0x7f:
+			quoted.WriteByte(' ') // control characters are not allowed
+		default:
+			quoted.WriteRune(r)
+		}
+	}
+	quoted.WriteByte('"')
+
+	return quoted.String()
+}
+
+func formatTimingDuration(duration time.Duration) string {
+	return strconv.FormatFloat(float64(duration)/float64(time.Millisecond), 'f', 3, 64) //nolint:gomnd // microseconds
+}
+
+// setTimingHeaders sets the traceresponse and Server-Timing headers of the response
+func setTimingHeaders(header http.Header, span trace.Span, recorder *timingRecorder) {
+	if !span.SpanContext().IsValid() {
+		return
+	}
+	header.Set(HeaderTraceResponse, TraceResponse(span.SpanContext()))
+	if recorder != nil {
+		header.Set(HeaderServerTiming, recorder.serverTiming(time.Now()))
+	}
+}
@@ -0,0 +1,161 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+
+	"emperror.dev/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.opentelemetry.io/otel/metric/instrument/syncfloat64"
+	"go.opentelemetry.io/otel/metric/instrument/syncint64"
+	"go.opentelemetry.io/otel/metric/unit"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	SpanMetricsKeySpanName   = attribute.Key("span.name")
+	SpanMetricsKeySpanKind   = attribute.Key("span.kind")
+	SpanMetricsKeyStatusCode = attribute.Key("status.code")
+
+	ServiceGraphKeyClient = attribute.Key("client")
+	ServiceGraphKeyServer = attribute.Key("server")
+
+	// ServiceGraphUnknown is the client of the edge, if the caller service is unknown (for example: an external caller)
+	ServiceGraphUnknown = "unknown"
+)
+
+/*
+SpanMetricsProcessor derives RED (rate, errors, duration) metrics from the ended spans, similar to
+the spanmetrics connector of the OpenTelemetry Collector. The metrics are grouped by service name, span name,
+span kind and status code. The span name of the HTTP server spans is the method and the route,
+the query of the other span names is cut, so the cardinality is bounded.
+The server spans produce service graph edges (client -> server), where the client is the caller service
+(client.service attribute, see ChiTracerMiddleware, or unknown) and the server is the own service.
+Only the recorded (sampled) spans are counted.
+*/
+type SpanMetricsProcessor struct {
+	calls    syncint64.Counter
+	errors   syncint64.Counter
+	duration syncfloat64.Histogram
+
+	graphRequests syncint64.Counter
+	graphFailed   syncint64.Counter
+	graphDuration syncfloat64.Histogram
+}
+
+func NewSpanMetricsProcessor(meter metric.Meter) (*SpanMetricsProcessor, error) {
+	p := &SpanMetricsProcessor{}
+	var err error
+	if p.calls, err = meter.SyncInt64().Counter("span.calls",
+		instrument.WithDescription("Number of the ended spans")); err != nil {
+		return nil, errors.Wrap(err, "unable to create metric")
+	}
+	if p.errors, err = meter.SyncInt64().Counter("span.errors",
+		instrument.WithDescription("Number of the ended spans with error status")); err != nil {
+		return nil, errors.Wrap(err, "unable to create metric")
+	}
+	if p.duration, err = meter.SyncFloat64().Histogram("span.duration",
+		instrument.WithDescription("Duration of the ended spans"), instrument.WithUnit(unit.Milliseconds)); err != nil {
+		return nil, errors.Wrap(err, "unable to create metric")
+	}
+	if p.graphRequests, err = meter.SyncInt64().Counter("servicegraph.requests",
+		instrument.WithDescription("Number of the requests between the services")); err != nil {
+		return nil, errors.Wrap(err, "unable to create metric")
+	}
+	if p.graphFailed, err = meter.SyncInt64().Counter("servicegraph.requests.failed",
+		instrument.WithDescription("Number of the failed requests between the services")); err != nil {
+		return nil, errors.Wrap(err, "unable to create metric")
+	}
+	if p.graphDuration, err = meter.SyncFloat64().Histogram("servicegraph.request.duration",
+		instrument.WithDescription("Duration of the requests between the services, measured by the server"),
+		instrument.WithUnit(unit.Milliseconds)); err != nil {
+		return nil, errors.Wrap(err, "unable to create metric")
+	}
+
+	return p, nil
+}
+
+func (p *SpanMetricsProcessor) OnStart(parent context.Context, span sdktrace.ReadWriteSpan) {}
+
+func (p *SpanMetricsProcessor) OnEnd(span sdktrace.ReadOnlySpan) {
+	ctx := context.Background()
+	service := spanServiceName(span)
+	failed := span.Status().Code == codes.Error
+	duration := durationMilliseconds(span.EndTime().Sub(span.StartTime()))
+
+	attrs := []attribute.KeyValue{
+		semconv.ServiceNameKey.String(service),
+		SpanMetricsKeySpanName.String(spanMetricsName(span)),
+		SpanMetricsKeySpanKind.String(span.SpanKind().String()),
+		SpanMetricsKeyStatusCode.String(span.Status().Code.String()),
+	}
+	p.calls.Add(ctx, 1, attrs...)
+	if failed {
+		p.errors.Add(ctx, 1, attrs...)
+	}
+	p.duration.Record(ctx, duration, attrs...)
+
+	if kind := span.SpanKind(); kind != trace.SpanKindServer && kind != trace.SpanKindConsumer {
+		return
+	}
+	edge := []attribute.KeyValue{
+		ServiceGraphKeyClient.String(spanClientService(span)),
+		ServiceGraphKeyServer.String(service),
+	}
+	p.graphRequests.Add(ctx, 1, edge...)
+	if failed {
+		p.graphFailed.Add(ctx, 1, edge...)
+	}
+	p.graphDuration.Record(ctx, duration, edge...)
+}
+
+func (p *SpanMetricsProcessor) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+func (p *SpanMetricsProcessor) ForceFlush(ctx context.Context) error {
+	return nil
+}
+
+func spanServiceName(span sdktrace.ReadOnlySpan) string {
+	if value, has := span.Resource().Set().Value(semconv.ServiceNameKey); has {
+		return value.AsString()
+	}
+
+	return ServiceGraphUnknown
+}
+
+// spanMetricsName returns the method and the route of the HTTP server spans, or the span name without the query
+func spanMetricsName(span sdktrace.ReadOnlySpan) string {
+	var method, route string
+	for _, attr := range span.Attributes() {
+		switch attr.Key {
+		case semconv.HTTPMethodKey:
+			method = attr.Value.AsString()
+		case semconv.HTTPRouteKey:
+			route = attr.Value.AsString()
+		}
+	}
+	if method != "" && route != "" {
+		return method + " " + route
+	}
+	name, _, _ := strings.Cut(span.Name(), "?")
+
+	return name
+}
+
+// spanClientService returns the client.service attribute of the server span
+func spanClientService(span sdktrace.ReadOnlySpan) string {
+	for _, attr := range span.Attributes() {
+		if attr.Key == SpanKeyClientService {
+			return attr.Value.AsString()
+		}
+	}
+
+	return ServiceGraphUnknown
+}
@@ -0,0 +1,331 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	URLParamTraceID = "traceID"
+
+	formatHTML = "html"
+)
+
+/*
+SpanStore is a SpanProcessor, which keeps the last ended spans in memory (ring buffer).
+The spans can be browsed by the Handler, without an external tracing backend.
+*/
+type SpanStore struct {
+	mu    sync.RWMutex
+	spans []sdktrace.ReadOnlySpan
+	next  int
+	full  bool
+}
+
+// NewSpanStore creates a SpanStore, which keeps the last size spans.
+func NewSpanStore(size int) *SpanStore {
+	return &SpanStore{
+		spans: make([]sdktrace.ReadOnlySpan, size),
+	}
+}
+
+func (s *SpanStore) OnStart(parent context.Context, span sdktrace.ReadWriteSpan) {}
+
+func (s *SpanStore) OnEnd(span sdktrace.ReadOnlySpan) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.spans[s.next] = span
+	s.next++
+	if s.next == len(s.spans) {
+		s.next = 0
+		s.full = true
+	}
+}
+
+func (s *SpanStore) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+func (s *SpanStore) ForceFlush(ctx context.Context) error {
+	return nil
+}
+
+// Spans returns the stored spans, oldest first.
+func (s *SpanStore) Spans() []sdktrace.ReadOnlySpan {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if !s.full {
+		return append([]sdktrace.ReadOnlySpan{}, s.spans[:s.next]...)
+	}
+
+	return append(append([]sdktrace.ReadOnlySpan{}, s.spans[s.next:]...), s.spans[:s.next]...)
+}
+
+// TraceSummary is a row of the trace list.
+type TraceSummary struct {
+	TraceID   string        `json:"traceID"`
+	RootName  string        `json:"rootName"`
+	Services  []string      `json:"services"`
+	SpanCount int           `json:"spanCount"`
+	ErrCount  int           `json:"errorCount"`
+	StartTime time.Time     `json:"startTime"`
+	Duration  time.Duration `json:"duration"`
+}
+
+// SpanNode is a span in the span tree of a trace.
+type SpanNode struct {
+	SpanID       string                 `json:"spanID"`
+	ParentSpanID string                 `json:"parentSpanID,omitempty"`
+	RemoteParent bool                   `json:"remoteParent,omitempty"`
+	Name         string                 `json:"name"`
+	Kind         string                 `json:"kind"`
+	Service      string                 `json:"service"`
+	StartTime    time.Time              `json:"startTime"`
+	Duration     time.Duration          `json:"duration"`
+	StatusCode   string                 `json:"statusCode"`
+	StatusDesc   string                 `json:"statusDescription,omitempty"`
+	Attributes   map[string]interface{} `json:"attributes,omitempty"`
+	Events       []SpanEvent            `json:"events,omitempty"`
+	Children     []*SpanNode            `json:"children,omitempty"`
+}
+
+type SpanEvent struct {
+	Name       string                 `json:"name"`
+	Time       time.Time              `json:"time"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// Traces returns the summary of the stored traces, latest first.
+func (s *SpanStore) Traces() []TraceSummary {
+	summaries := map[trace.TraceID]*TraceSummary{}
+	ends := map[trace.TraceID]time.Time{}
+	for _, span := range s.Spans() {
+		traceID := span.SpanContext().TraceID()
+		summary, has := summaries[traceID]
+		if !has {
+			summary = &TraceSummary{TraceID: traceID.String(), StartTime: span.StartTime()}
+			summaries[traceID] = summary
+		}
+		summary.SpanCount++
+		if span.Status().Code == codes.Error {
+			summary.ErrCount++
+		}
+		if !span.Parent().IsValid() || span.Parent().IsRemote() || summary.RootName == "" {
+			summary.RootName = span.Name()
+		}
+		if span.StartTime().Before(summary.StartTime) {
+			summary.StartTime = span.StartTime()
+		}
+		if span.EndTime().After(ends[traceID]) {
+			ends[traceID] = span.EndTime()
+		}
+		summary.Services = appendUnique(summary.Services, spanService(span))
+	}
+
+	list := make([]TraceSummary, 0, len(summaries))
+	for traceID, summary := range summaries {
+		summary.Duration = ends[traceID].Sub(summary.StartTime)
+		list = append(list, *summary)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].StartTime.After(list[j].StartTime)
+	})
+
+	return list
+}
+
+// Trace returns the span tree of a trace. Spans without a known parent are roots.
+func (s *SpanStore) Trace(traceID trace.TraceID) []*SpanNode {
+	nodes := map[trace.SpanID]*SpanNode{}
+	parents := map[trace.SpanID]trace.SpanID{}
+	order := []trace.SpanID{}
+	for _, span := range s.Spans() {
+		if span.SpanContext().TraceID() != traceID {
+			continue
+		}
+		spanID := span.SpanContext().SpanID()
+		nodes[spanID] = newSpanNode(span)
+		parents[spanID] = span.Parent().SpanID()
+		order = append(order, spanID)
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return nodes[order[i]].StartTime.Before(nodes[order[j]].StartTime)
+	})
+
+	roots := []*SpanNode{}
+	for _, spanID := range order {
+		if parent, has := nodes[parents[spanID]]; has {
+			parent.Children = append(parent.Children, nodes[spanID])
+		} else {
+			roots = append(roots, nodes[spanID])
+		}
+	}
+
+	return roots
+}
+
+func newSpanNode(span sdktrace.ReadOnlySpan) *SpanNode {
+	node := &SpanNode{
+		SpanID:     span.SpanContext().SpanID().String(),
+		Name:       span.Name(),
+		Kind:       span.SpanKind().String(),
+		Service:    spanService(span),
+		StartTime:  span.StartTime(),
+		Duration:   span.EndTime().Sub(span.StartTime()),
+		StatusCode: span.Status().Code.String(),
+		StatusDesc: span.Status().Description,
+		Attributes: attributesToMap(span.Attributes()),
+	}
+	if span.Parent().IsValid() {
+		node.ParentSpanID = span.Parent().SpanID().String()
+		node.RemoteParent = span.Parent().IsRemote()
+	}
+	for _, event := range span.Events() {
+		node.Events = append(node.Events, SpanEvent{
+			Name:       event.Name,
+			Time:       event.Time,
+			Attributes: attributesToMap(event.Attributes),
+		})
+	}
+
+	return node
+}
+
+func spanService(span sdktrace.ReadOnlySpan) string {
+	if span.Resource() == nil {
+		return ""
+	}
+	if value, has := span.Resource().Set().Value(semconv.ServiceNameKey); has {
+		return value.AsString()
+	}
+
+	return ""
+}
+
+func attributesToMap(attrs []attribute.KeyValue) map[string]interface{} {
+	if len(attrs) == 0 {
+		return nil
+	}
+	values := make(map[string]interface{}, len(attrs))
+	for _, attr := range attrs {
+		values[string(attr.Key)] = attr.Value.AsInterface()
+	}
+
+	return values
+}
+
+func appendUnique(list []string, item string) []string {
+	for _, has := range list {
+		if has == item {
+			return list
+		}
+	}
+
+	return append(list, item)
+}
+
+/*
+Handler returns the HTTP handler of the stored traces, should be mounted to /debug/traces:
+
+	/                the list of the traces
+	/{traceID}       the span tree of the trace
+
+The response is JSON, or HTML if the format=html query parameter is set or the client accepts text/html.
+*/
+func (s *SpanStore) Handler() http.Handler {
+	r := chi.NewRouter()
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		writeDebugResponse(w, r, debugTracesTemplate, struct {
+			Base   string         `json:"-"`
+			Traces []TraceSummary `json:"traces"`
+		}{strings.TrimSuffix(r.URL.Path, "/"), s.Traces()})
+	})
+	r.Get("/{"+URLParamTraceID+"}", func(w http.ResponseWriter, r *http.Request) {
+		traceID, err := trace.TraceIDFromHex(chi.URLParam(r, URLParamTraceID))
+		if err != nil {
+			http.Error(w, errors.Wrap(err, "invalid trace ID").Error(), http.StatusBadRequest)
+
+			return
+		}
+		roots := s.Trace(traceID)
+		if len(roots) == 0 {
+			http.Error(w, "trace not found", http.StatusNotFound)
+
+			return
+		}
+		writeDebugResponse(w, r, debugTraceTemplate, struct {
+			TraceID string      `json:"traceID"`
+			Spans   []*SpanNode `json:"spans"`
+		}{traceID.String(), roots})
+	})
+
+	return r
+}
+
+func writeDebugResponse(w http.ResponseWriter, r *http.Request, tmpl *template.Template, data interface{}) {
+	if r.URL.Query().Get("format") == formatHTML ||
+		(r.URL.Query().Get("format") == "" && strings.Contains(r.Header.Get("Accept"), "text/html")) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := tmpl.Execute(w, data); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+var debugTracesTemplate = template.Must(template.New("traces").Parse(`<!DOCTYPE html>
+<html><head><title>Traces</title></head><body>
+<h1>Traces</h1>
+<table border="1" cellpadding="4">
+<tr><th>Trace ID</th><th>Root</th><th>Services</th><th>Spans</th><th>Errors</th><th>Start</th><th>Duration</th></tr>
+{{- range .Traces}}
+<tr><td><a href="{{$.Base}}/{{.TraceID}}?format=html">{{.TraceID}}</a></td><td>{{.RootName}}</td><td>{{range .Services}}{{.}} {{end}}</td>
+<td>{{.SpanCount}}</td><td>{{.ErrCount}}</td><td>{{.StartTime.Format "15:04:05.000"}}</td><td>{{.Duration}}</td></tr>
+{{- end}}
+</table>
+</body></html>
+`))
+
+var debugTraceTemplate = template.Must(template.New("trace").Parse(`<!DOCTYPE html>
+<html><head><title>Trace {{.TraceID}}</title></head><body>
+<h1>Trace {{.TraceID}}</h1>
+<p><a href="./?format=html">All traces</a></p>
+{{- define "spans"}}
+<ul>
+{{- range .}}
+<li><b>{{.Name}}</b> [{{.Kind}}] {{.Service}} {{.Duration}} {{.StatusCode}}{{if .StatusDesc}}: {{.StatusDesc}}{{end}}
+<br><small>span {{.SpanID}}{{if .ParentSpanID}}, parent {{.ParentSpanID}}{{if .RemoteParent}} (remote){{end}}{{end}}</small>
+{{- if .Attributes}}<br><small>{{range $key, $value := .Attributes}}{{$key}}={{$value}} {{end}}</small>{{end}}
+{{- range .Events}}<br><small>event {{.Name}} {{range $key, $value := .Attributes}}{{$key}}={{$value}} {{end}}</small>{{end}}
+{{- if .Children}}{{template "spans" .Children}}{{end}}
+</li>
+{{- end}}
+</ul>
+{{- end}}
+{{template "spans" .Spans}}
+</body></html>
+`))
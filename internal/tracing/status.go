@@ -0,0 +1,57 @@
+package tracing
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+/*
+statusResponseWriter sets the status of the server span by the response code.
+The handlers end the span, so the status is set, when the header is written.
+The traceresponse and Server-Timing headers are set here, too.
+*/
+type statusResponseWriter struct {
+	http.ResponseWriter
+	span        trace.Span
+	recorder    *timingRecorder
+	wroteHeader bool
+}
+
+func newStatusResponseWriter(w http.ResponseWriter, span trace.Span, recorder *timingRecorder) *statusResponseWriter {
+	return &statusResponseWriter{ResponseWriter: w, span: span, recorder: recorder}
+}
+
+func (w *statusResponseWriter) WriteHeader(statusCode int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		setTimingHeaders(w.Header(), w.span, w.recorder)
+		w.span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(statusCode)...)
+		if code, desc := semconv.SpanStatusFromHTTPStatusCodeAndSpanKind(statusCode, trace.SpanKindServer); code == codes.Error {
+			w.span.SetStatus(code, desc)
+		}
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *statusResponseWriter) Write(data []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	return w.ResponseWriter.Write(data) //nolint:wrapcheck // transparent wrapper
+}
+
+func (w *statusResponseWriter) Flush() {
+	if flusher, is := w.ResponseWriter.(http.Flusher); is {
+		flusher.Flush()
+	}
+}
+
+// RecordError records the error as an exception event (with stack trace) and sets the error status of the span
+func RecordError(span trace.Span, err error) {
+	span.RecordError(err, trace.WithStackTrace(true))
+	span.SetStatus(codes.Error, err.Error())
+}
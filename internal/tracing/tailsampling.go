@@ -0,0 +1,266 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	tailSamplingMinTick          = 100 * time.Millisecond
+	tailSamplingDefaultDecisions = 1000
+	attributeRuleAny             = "*"
+)
+
+// TailSamplingConfig is the policy and the limits of TailSamplingProcessor
+type TailSamplingConfig struct {
+	// Latency keeps the traces, which have a span longer than this (0: disabled)
+	Latency time.Duration
+	// Attributes are key=value rules, a trace is kept, if a span has a matching attribute (value * matches any)
+	Attributes []string
+	// DecisionWait is the max time to wait for the local root span, counted from the first ended span
+	DecisionWait time.Duration
+	// MaxTraces is the max number of buffered traces, the oldest trace is decided, if it's exceeded
+	MaxTraces int
+	// MaxSpans is the max number of buffered spans in a trace, the trace is decided, if it's exceeded
+	MaxSpans int
+}
+
+type tailTrace struct {
+	firstEnd time.Time
+	spans    []sdktrace.ReadOnlySpan
+}
+
+/*
+TailSamplingProcessor buffers the ended spans of the local traces and forwards them to the next span processor
+(the exporter batcher), if the trace is kept. The decision is made, when the local root span
+(without parent or with remote parent) ends, the DecisionWait timeout expires or the limits are reached.
+A trace is kept, if it has an error span, a span longer than Latency or a span matching the Attributes rules.
+Late spans of a decided trace follow the decision.
+*/
+type TailSamplingProcessor struct {
+	next       sdktrace.SpanProcessor
+	config     TailSamplingConfig
+	attributes map[attribute.Key]string
+	log        logr.Logger
+
+	mu            sync.Mutex
+	traces        map[trace.TraceID]*tailTrace
+	traceOrder    []trace.TraceID
+	decisions     map[trace.TraceID]bool
+	decisionOrder []trace.TraceID
+	kept          int64
+	dropped       int64
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewTailSamplingProcessor creates the processor, config must be valid (see TailSamplingConfig.Validate)
+func NewTailSamplingProcessor(next sdktrace.SpanProcessor, config TailSamplingConfig, log logr.Logger) *TailSamplingProcessor {
+	attributes, _ := parseAttributeRules(config.Attributes) //nolint:errcheck // validated
+
+	p := &TailSamplingProcessor{
+		next:       next,
+		config:     config,
+		attributes: attributes,
+		log:        log,
+		traces:     map[trace.TraceID]*tailTrace{},
+		decisions:  map[trace.TraceID]bool{},
+		stop:       make(chan struct{}),
+	}
+	if config.DecisionWait > 0 {
+		tick := config.DecisionWait / 4 //nolint:gomnd // check often enough
+		if tick < tailSamplingMinTick {
+			tick = tailSamplingMinTick
+		}
+		p.wg.Add(1)
+		go p.decideExpired(tick)
+	}
+
+	return p
+}
+
+func (c TailSamplingConfig) Validate() error {
+	_, err := parseAttributeRules(c.Attributes)
+
+	return err
+}
+
+func parseAttributeRules(rules []string) (map[attribute.Key]string, error) {
+	attributes := map[attribute.Key]string{}
+	for _, rule := range rules {
+		if rule == "" {
+			continue
+		}
+		key, value, found := strings.Cut(rule, "=")
+		if !found {
+			value = attributeRuleAny
+		}
+		if key == "" {
+			return nil, errors.WithDetails(errors.NewPlain("invalid attribute rule"), "rule", rule)
+		}
+		attributes[attribute.Key(key)] = value
+	}
+
+	return attributes, nil
+}
+
+func (p *TailSamplingProcessor) OnStart(parent context.Context, span sdktrace.ReadWriteSpan) {
+	p.next.OnStart(parent, span)
+}
+
+func (p *TailSamplingProcessor) OnEnd(span sdktrace.ReadOnlySpan) {
+	traceID := span.SpanContext().TraceID()
+	isLocalRoot := !span.Parent().IsValid() || span.Parent().IsRemote()
+
+	p.mu.Lock()
+	if keep, decided := p.decisions[traceID]; decided {
+		p.mu.Unlock()
+		if keep {
+			p.next.OnEnd(span)
+		}
+
+		return
+	}
+
+	var forward []sdktrace.ReadOnlySpan
+	buffered, has := p.traces[traceID]
+	if !has {
+		if p.config.MaxTraces > 0 && len(p.traces) >= p.config.MaxTraces && len(p.traceOrder) > 0 {
+			forward = p.decideLocked(p.traceOrder[0])
+		}
+		buffered = &tailTrace{firstEnd: time.Now()}
+		p.traces[traceID] = buffered
+		p.traceOrder = append(p.traceOrder, traceID)
+	}
+	buffered.spans = append(buffered.spans, span)
+
+	if isLocalRoot || (p.config.MaxSpans > 0 && len(buffered.spans) >= p.config.MaxSpans) {
+		forward = append(forward, p.decideLocked(traceID)...)
+	}
+	p.mu.Unlock()
+
+	for _, keptSpan := range forward {
+		p.next.OnEnd(keptSpan)
+	}
+}
+
+/*
+decideLocked evaluates the policy on the buffered spans, removes the trace from the buffer and
+returns the spans to be forwarded. Must be called with p.mu locked.
+*/
+func (p *TailSamplingProcessor) decideLocked(traceID trace.TraceID) []sdktrace.ReadOnlySpan {
+	buffered, has := p.traces[traceID]
+	if !has {
+		return nil
+	}
+	delete(p.traces, traceID)
+	for i, id := range p.traceOrder {
+		if id == traceID {
+			p.traceOrder = append(p.traceOrder[:i], p.traceOrder[i+1:]...)
+
+			break
+		}
+	}
+
+	keep := p.shouldKeep(buffered.spans)
+	p.decisions[traceID] = keep
+	p.decisionOrder = append(p.decisionOrder, traceID)
+	maxDecisions := p.config.MaxTraces
+	if maxDecisions <= 0 {
+		maxDecisions = tailSamplingDefaultDecisions
+	}
+	for len(p.decisionOrder) > maxDecisions {
+		delete(p.decisions, p.decisionOrder[0])
+		p.decisionOrder = p.decisionOrder[1:]
+	}
+
+	if !keep {
+		p.dropped++
+
+		return nil
+	}
+	p.kept++
+
+	return buffered.spans
+}
+
+func (p *TailSamplingProcessor) shouldKeep(spans []sdktrace.ReadOnlySpan) bool {
+	for _, span := range spans {
+		if span.Status().Code == codes.Error {
+			return true
+		}
+		if p.config.Latency > 0 && span.EndTime().Sub(span.StartTime()) >= p.config.Latency {
+			return true
+		}
+		for _, attr := range span.Attributes() {
+			if value, has := p.attributes[attr.Key]; has && (value == attributeRuleAny || value == attr.Value.Emit()) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (p *TailSamplingProcessor) decideExpired(tick time.Duration) {
+	defer p.wg.Done()
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case now := <-ticker.C:
+			p.decideAll(func(buffered *tailTrace) bool {
+				return now.Sub(buffered.firstEnd) >= p.config.DecisionWait
+			})
+		}
+	}
+}
+
+func (p *TailSamplingProcessor) decideAll(filter func(*tailTrace) bool) {
+	var forward []sdktrace.ReadOnlySpan
+	p.mu.Lock()
+	for _, traceID := range append([]trace.TraceID{}, p.traceOrder...) {
+		if filter(p.traces[traceID]) {
+			forward = append(forward, p.decideLocked(traceID)...)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, span := range forward {
+		p.next.OnEnd(span)
+	}
+}
+
+// Shutdown decides the buffered traces and shuts down the next span processor.
+func (p *TailSamplingProcessor) Shutdown(ctx context.Context) error {
+	p.stopOnce.Do(func() {
+		close(p.stop)
+	})
+	p.wg.Wait()
+	p.decideAll(func(*tailTrace) bool { return true })
+
+	p.mu.Lock()
+	p.log.Info("Tail sampling stopped", "kept", p.kept, "dropped", p.dropped)
+	p.mu.Unlock()
+
+	return p.next.Shutdown(ctx) //nolint:wrapcheck // transparent wrapper
+}
+
+// ForceFlush flushes the next span processor. The undecided traces are kept in the buffer.
+func (p *TailSamplingProcessor) ForceFlush(ctx context.Context) error {
+	return p.next.ForceFlush(ctx) //nolint:wrapcheck // transparent wrapper
+}
@@ -1,23 +1,25 @@
 package tracing
 
 import (
+	"context"
 	"net/http"
 	"os"
 	"regexp"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-logr/logr"
+	"github.com/pgillich/opentracing-example/internal/logger"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/baggage"
 	"go.opentelemetry.io/otel/exporters/jaeger"
 	"go.opentelemetry.io/otel/propagation"
-	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.11.0"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
 	"go.opentelemetry.io/otel/trace"
 
 	"github.com/pgillich/opentracing-example/internal/buildinfo"
@@ -34,7 +36,6 @@ func (e *ErrorHandler) Handle(err error) {
 var errorHandler = &ErrorHandler{}
 var onceSetOtel sync.Once      //nolint:gochecknoglobals // local once
 var onceBodySetOtel = func() { //nolint:gochecknoglobals // local once
-	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
 	otel.SetErrorHandler(errorHandler)
 	otel.SetLogger(*errorHandler.log)
 }
@@ -45,45 +46,159 @@ func SetErrorHandlerLogger(log *logr.Logger) {
 
 const (
 	StateKeyClientCommand = "client_command"
+	// StateKeyClientService is the service name of the caller in the tracestate, see ChiTracerMiddleware
+	StateKeyClientService = "client_service"
+	// SpanKeyClientService is the service name of the caller on the server span
+	SpanKeyClientService  = attribute.Key("client.service")
 	SpanKeyComponent      = "component"
 	SpanKeyComponentValue = "opentracing-example"
 )
 
-func InitTracer(exporter sdktrace.SpanExporter, sampler sdktrace.Sampler, service string, instance string, command string, log logr.Logger) *sdktrace.TracerProvider {
-	// For the demonstration, use sdktrace.AlwaysSample sampler to sample all traces.
-	// In a production application, use sdktrace.ProbabilitySampler with a desired probability.
+// TracerOption configures the optional parts of the TracerProvider, built by InitTracer
+type TracerOption func(*tracerOptions)
+
+type tracerOptions struct {
+	propagator            propagation.TextMapPropagator
+	openTracingPropagator propagation.TextMapPropagator
+	resourceAttributes    []attribute.KeyValue
+	exportBatchTimeout    time.Duration
+	exportQueue           *PersistentExporter
+	redactor              *Redactor
+	spanProcessors        []sdktrace.SpanProcessor
+	exportWrappers        []func(next sdktrace.SpanProcessor) sdktrace.SpanProcessor
+}
+
+/*
+WithPropagator sets the global propagator (see NewPropagator), so the instrumentations, which use
+otel.GetTextMapPropagator (for example otelhttp), inject and extract the same headers as the handlers
+*/
+func WithPropagator(propagator propagation.TextMapPropagator) TracerOption {
+	return func(options *tracerOptions) {
+		options.propagator = propagator
+	}
+}
+
+// WithSpanProcessor registers a span processor next to the exporter
+func WithSpanProcessor(spanProcessor sdktrace.SpanProcessor) TracerOption {
+	return func(options *tracerOptions) {
+		options.spanProcessors = append(options.spanProcessors, spanProcessor)
+	}
+}
+
+// WithExportBatchTimeout sets the max delay of the export, the spans are not flushed by the handlers
+func WithExportBatchTimeout(timeout time.Duration) TracerOption {
+	return func(options *tracerOptions) {
+		options.exportBatchTimeout = timeout
+	}
+}
+
+// WithResourceAttributes adds extra resource attributes, these override the detected ones
+func WithResourceAttributes(attrs ...attribute.KeyValue) TracerOption {
+	return func(options *tracerOptions) {
+		options.resourceAttributes = append(options.resourceAttributes, attrs...)
+	}
+}
+
+// WithRedaction masks the sensitive values of the spans for the exporter and for the span processors
+func WithRedaction(redactor *Redactor) TracerOption {
+	return func(options *tracerOptions) {
+		options.redactor = redactor
+	}
+}
+
+// WithExportWrapper wraps the batch span processor of the exporter, for example by a filtering span processor
+func WithExportWrapper(wrapper func(next sdktrace.SpanProcessor) sdktrace.SpanProcessor) TracerOption {
+	return func(options *tracerOptions) {
+		options.exportWrappers = append(options.exportWrappers, wrapper)
+	}
+}
+
+func InitTracer(exporter sdktrace.SpanExporter, sampler sdktrace.Sampler, service string, instance string, command string, log logr.Logger, opts ...TracerOption) *TracerProvider {
+	options := &tracerOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	// The sampler is created by NewSampler, see the --sampler and --samplerRules flags.
+	// For the demonstration, parentbased_always_on is the default, which samples all traces.
+	// The host, OS, process (process.pid), container and Kubernetes attributes are detected by NewResource.
 	// semconv keys are defined in https://github.com/open-telemetry/opentelemetry-specification/tree/main/semantic_conventions/trace
 	attrs := []attribute.KeyValue{
 		semconv.ServiceNamespaceKey.String("opentracing-example"),
 		semconv.ServiceNameKey.String(service),
 		semconv.ServiceInstanceIDKey.String(instance),
 		semconv.ServiceVersionKey.String(buildinfo.Version),
-		attribute.Int("attrID", os.Getpid()),
 	}
 	if command != "" {
 		attrs = append(attrs, attribute.String(StateKeyClientCommand, command))
 	}
+	res := NewResource(context.Background(), attrs, options.resourceAttributes, log)
+	if logExporter, is := logger.GetExporter().(*LogExporter); is {
+		if logService := logger.ServiceOf(log); logService != "" {
+			logExporter.setService(logService, res, options.redactor)
+		}
+	}
 	providerOptions := []sdktrace.TracerProviderOption{
 		sdktrace.WithSampler(sampler),
-		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, attrs...)),
+		sdktrace.WithResource(res),
 	}
 	if exporter != nil {
-		providerOptions = append(providerOptions, sdktrace.WithBatcher(exporter))
+		if options.exportQueue != nil {
+			exporter = options.exportQueue.start(exporter)
+		}
+		batchOptions := []sdktrace.BatchSpanProcessorOption{}
+		if options.exportBatchTimeout > 0 {
+			batchOptions = append(batchOptions, sdktrace.WithBatchTimeout(options.exportBatchTimeout))
+		}
+		exportProcessor := sdktrace.NewBatchSpanProcessor(exporter, batchOptions...)
+		if options.redactor != nil {
+			exportProcessor = NewRedactionProcessor(exportProcessor, options.redactor)
+		}
+		for _, wrapper := range options.exportWrappers {
+			exportProcessor = wrapper(exportProcessor)
+		}
+		providerOptions = append(providerOptions, sdktrace.WithSpanProcessor(exportProcessor))
+	}
+	var timingProcessor sdktrace.SpanProcessor = newServerTimingProcessor()
+	if options.redactor != nil {
+		// the span names are written to the Server-Timing desc of the response
+		timingProcessor = NewRedactionProcessor(timingProcessor, options.redactor)
+	}
+	providerOptions = append(providerOptions, sdktrace.WithSpanProcessor(timingProcessor))
+	for _, spanProcessor := range options.spanProcessors {
+		if options.redactor != nil {
+			spanProcessor = NewRedactionProcessor(spanProcessor, options.redactor)
+		}
+		providerOptions = append(providerOptions, sdktrace.WithSpanProcessor(spanProcessor))
+	}
+	tp := &TracerProvider{TracerProvider: sdktrace.NewTracerProvider(providerOptions...)}
+	if options.openTracingPropagator != nil {
+		tp.bridgeTracer, tp.bridgeCleanup = setOpenTracingBridge(tp.TracerProvider, options.openTracingPropagator, log)
 	}
-	tp := sdktrace.NewTracerProvider(providerOptions...)
 
 	if errorHandler.log == nil {
 		errorHandler.log = &log
 	}
 	onceSetOtel.Do(onceBodySetOtel)
+	if options.propagator != nil {
+		otel.SetTextMapPropagator(options.propagator)
+	}
 
 	return tp
 }
 
-func ChiTracerMiddleware(tr trace.Tracer, instance string, l logr.Logger) func(next http.Handler) http.Handler {
+/*
+ChiTracerMiddleware starts the server span, the parent is extracted from the request by the propagator.
+The span status is set by the response code (5xx is error). The span is ended by the handler.
+The traceresponse and Server-Timing (total and child span durations) headers are added to the response.
+The service name of the caller is read from the tracestate (client.service attribute) and it's replaced by
+the own service name, so the downstream services know the caller, too.
+*/
+func ChiTracerMiddleware(tr trace.Tracer, propagator propagation.TextMapPropagator, service string, instance string, l logr.Logger) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		fn := func(w http.ResponseWriter, r *http.Request) {
-			routePath := chi.RouteContext(r.Context()).RoutePath
+			// The middleware is registered in a route group, so the route pattern is already found
+			routePath := chi.RouteContext(r.Context()).RoutePattern()
 			if routePath == "" {
 				if r.URL.RawPath != "" {
 					routePath = r.URL.RawPath
@@ -92,17 +207,19 @@ func ChiTracerMiddleware(tr trace.Tracer, instance string, l logr.Logger) func(n
 				}
 			}
 
-			ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+			ctx := propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
 			span := trace.SpanFromContext(ctx)
 			clientCommand := ""
+			clientService := ""
 			if span.SpanContext().IsValid() {
 				spanValues, spanValuesErr := span.SpanContext().MarshalJSON()
 				l.WithValues(
 					"span", spanValues,
 					"spanErr", spanValuesErr,
 					"bag", baggage.FromContext(ctx).String(),
-				).Info("IN Span")
+				).V(1).Info("IN Span")
 				clientCommand = span.SpanContext().TraceState().Get(StateKeyClientCommand)
+				clientService = span.SpanContext().TraceState().Get(StateKeyClientService)
 			} else {
 				command := r.Method + " " + r.URL.String()
 
@@ -125,9 +242,11 @@ func ChiTracerMiddleware(tr trace.Tracer, instance string, l logr.Logger) func(n
 					"span", spanValues,
 					"spanErr", spanValuesErr,
 					"bag", bag,
-				).Info("NEW Span")
+				).V(1).Info("NEW Span")
 			}
 
+			ctx = contextWithServiceState(ctx, service, l)
+
 			ctx, span = tr.Start(ctx, "IN HTTP "+r.Method+" "+r.URL.String(),
 				trace.WithAttributes(semconv.NetAttributesFromHTTPRequest("tcp", r)...),
 				trace.WithAttributes(semconv.HTTPClientAttributesFromHTTPRequest(r)...),
@@ -138,6 +257,9 @@ func ChiTracerMiddleware(tr trace.Tracer, instance string, l logr.Logger) func(n
 					attribute.String(SpanKeyComponent, SpanKeyComponentValue),
 				),
 			)
+			if clientService != "" {
+				span.SetAttributes(SpanKeyClientService.String(clientService))
+			}
 
 			uk := attribute.Key("username") // from HTTP header
 			span.AddEvent("IN req from user", trace.WithAttributes(append(append(
@@ -146,14 +268,35 @@ func ChiTracerMiddleware(tr trace.Tracer, instance string, l logr.Logger) func(n
 				uk.String("testUser"),
 			)...))
 
+			var recorder *timingRecorder
+			if span.IsRecording() {
+				recorder = &timingRecorder{spanID: span.SpanContext().SpanID(), start: time.Now()}
+				ctx = contextWithTimingRecorder(ctx, recorder)
+			}
+
+			ctx = ContextWithOpenTracingSpan(ctx, span)
+			ctx = logger.ContextWithRequestLogger(ctx, r, span, l)
 			r = r.WithContext(ctx)
-			next.ServeHTTP(w, r)
+			next.ServeHTTP(newStatusResponseWriter(w, span, recorder), r)
 		}
 
 		return http.HandlerFunc(fn)
 	}
 }
 
+// contextWithServiceState sets the service name in the tracestate of the parent span context
+func contextWithServiceState(ctx context.Context, service string, l logr.Logger) context.Context {
+	spanContext := trace.SpanContextFromContext(ctx)
+	traceState, err := spanContext.TraceState().Insert(StateKeyClientService, EncodeTracestateValue(service))
+	if err != nil {
+		l.Error(err, "unable to set service in state")
+
+		return ctx
+	}
+
+	return trace.ContextWithSpanContext(ctx, spanContext.WithTraceState(traceState))
+}
+
 func JaegerProvider(url string) (sdktrace.SpanExporter, error) {
 	if url == "" || url == "-" {
 		return nil, nil
@@ -166,8 +309,8 @@ func JaegerProvider(url string) (sdktrace.SpanExporter, error) {
 
 func NewBaggage(instance, command string) (baggage.Baggage, error) {
 	return baggage.Parse(strings.Join([]string{ //nolint:gocritic // strings.Join is better
-		"baggID=" + strconv.Itoa(os.Getpid()),
-		"baggCommand=" + encodeBaggageValue(command),
+		BaggageKeyID + "=" + strconv.Itoa(os.Getpid()),
+		BaggageKeyCommand + "=" + encodeBaggageValue(command),
 	}, ","))
 }
 
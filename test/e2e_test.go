@@ -2,21 +2,35 @@ package test
 
 import (
 	"context"
+	"encoding/json"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/go-chi/chi/v5"
+	chi_middleware "github.com/go-chi/chi/v5/middleware"
 	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/funcr"
+	"github.com/opentracing/opentracing-go"
 	"github.com/pgillich/opentracing-example/cmd"
 	"github.com/pgillich/opentracing-example/internal"
 	"github.com/pgillich/opentracing-example/internal/logger"
 	"github.com/pgillich/opentracing-example/internal/model"
 	"github.com/pgillich/opentracing-example/internal/tracing"
 	"github.com/stretchr/testify/suite"
+	"go.opentelemetry.io/otel"
+	otbridge "go.opentelemetry.io/otel/bridge/opentracing"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 )
 
 type E2ETestSuite struct {
@@ -42,6 +56,177 @@ type TestClient struct {
 
 type runTestServerType func(typeName string, instance string, config internal.ConfigSetter, args []string, newService model.NewService, log logr.Logger) *TestServer
 
+func (s *E2ETestSuite) TestLogConfig() {
+	log := logger.GetLogger(s.T().Name())
+	tracing.SetErrorHandlerLogger(&log)
+	var runTestServer runTestServerType = runTestServerCmd
+
+	s.T().Setenv("LOG_FORMAT", logger.FormatJSON)
+	beServer1 := runTestServer("backend", "backend-1", &internal.BackendConfig{},
+		[]string{"PONG_1", "--log-level", "warn", "--log-levels", "backend=debug,chi=trace"}, internal.NewBackendService, log,
+	)
+	defer beServer1.cancel()
+
+	s.True(logger.GetLogger("backend").V(1).Enabled(), "backend debug")
+	s.False(logger.GetLogger("backend").V(2).Enabled(), "backend trace")
+	s.True(logger.GetLogger("chi").V(2).Enabled(), "chi trace")
+	s.False(logger.GetLogger("frontend").Enabled(), "frontend info")
+	s.False(logger.GetLogger("frontend").V(1).Enabled(), "frontend debug")
+
+	s.ErrorIs(logger.Configure(logger.Config{Level: "loud"}), logger.ErrInvalidLogLevel, "invalid level")
+	s.ErrorIs(logger.Configure(logger.Config{Levels: []string{"backend"}}), logger.ErrInvalidLogLevel, "invalid override")
+	s.ErrorIs(logger.Configure(logger.Config{Format: "xml"}), logger.ErrInvalidLogFormat, "invalid format")
+	s.NoError(logger.Configure(logger.Config{}), "default config")
+}
+
+func (s *E2ETestSuite) TestLogExport() {
+	log := logger.GetLogger(s.T().Name())
+	tracing.SetErrorHandlerLogger(&log)
+	var runTestServer runTestServerType = runTestServerCmd
+
+	beServer1 := runTestServer("backend", "backend-1", &internal.BackendConfig{}, []string{"PONG_1"}, internal.NewBackendService, log)
+	defer beServer1.cancel()
+	feServer1 := runTestServer("frontend", "frontend", &internal.FrontendConfig{},
+		frontendArgs("--spanStoreSize", "100", "--log-export", logger.ExportSpan, "--log-levels", "frontend=debug"), internal.NewFrontendService, log,
+	)
+	s.sendPingFrontend(feServer1, []string{beServer1.addr}, log)
+
+	traces := struct {
+		Traces []tracing.TraceSummary `json:"traces"`
+	}{}
+	s.getJSON(feServer1, "/debug/traces", &traces)
+	s.Require().Len(traces.Traces, 1, "frontend traces")
+	traceTree := struct {
+		Spans []*tracing.SpanNode `json:"spans"`
+	}{}
+	s.getJSON(feServer1, "/debug/traces/"+traces.Traces[0].TraceID, &traceTree)
+	s.Require().Len(traceTree.Spans, 1, "frontend root spans")
+	var logEvent *tracing.SpanEvent
+	for e, event := range traceTree.Spans[0].Events {
+		if event.Name == "Span END" {
+			logEvent = &traceTree.Spans[0].Events[e]
+		}
+	}
+	s.Require().NotNil(logEvent, "log event")
+	s.Equal(logger.SeverityDebug, logEvent.Attributes[string(logger.KeySeverity)], "log severity")
+	s.Equal("frontend", logEvent.Attributes[string(logger.KeyLogger)], "logger name")
+	s.Equal("frontend", logEvent.Attributes["service"], "log value")
+	feServer1.cancel()
+
+	receiver := newOtlpReceiver()
+	defer receiver.server.Close()
+	feServer2 := runTestServer("frontend", "frontend", &internal.FrontendConfig{}, frontendArgs(
+		"--log-export", tracing.ExporterOtlpHTTPJSON, "--log-export-url", receiver.server.URL+"/v1/logs", "--log-levels", "frontend=debug",
+		"--redactAttributes", "^span$",
+	), internal.NewFrontendService, log)
+	defer feServer2.cancel()
+	s.sendPingFrontend(feServer2, []string{beServer1.addr}, log)
+
+	s.Eventually(func() bool {
+		return strings.Contains(receiver.body(), `"Span END"`)
+	}, 5*time.Second, 100*time.Millisecond, "exported log record")
+	s.NotEmpty(receiver.traceIDs(), "trace ID of the log record")
+	s.Contains(receiver.body(), `"severityText":"DEBUG"`, "severity")
+	s.Contains(receiver.body(), `"frontend.opentracing-example"`, "service name")
+	s.Contains(receiver.body(), `{"key":"service.instance.id","value":{"stringValue":"frontend"}}`, "resource of the tracer")
+	s.Contains(receiver.body(), `{"key":"span","value":{"stringValue":"`+tracing.RedactedValue+`"}}`, "redacted attribute")
+}
+
+func (s *E2ETestSuite) TestLogLevelAdmin() {
+	log := logger.GetLogger(s.T().Name())
+	tracing.SetErrorHandlerLogger(&log)
+	var runTestServer runTestServerType = runTestServerCmd
+
+	// the changed levels must not leak into the next tests, which use the default level
+	defer func() {
+		s.NoError(logger.SetLevel("", logger.DefaultLevel, 0), "restore levels")
+	}()
+
+	beServer1 := runTestServer("backend", "backend-1", &internal.BackendConfig{}, []string{"PONG_1", "--adminEndpoints"}, internal.NewBackendService, log)
+	defer beServer1.cancel()
+	beServer2 := runTestServer("backend", "backend-2", &internal.BackendConfig{}, []string{"PONG_2"}, internal.NewBackendService, log)
+	defer beServer2.cancel()
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "http://"+beServer2.addr+logger.AdminLogLevelPath, http.NoBody)
+	s.Require().NoError(err, "disabled admin req")
+	resp, err := beServer2.testServer.Client().Do(req)
+	s.Require().NoError(err, "disabled admin do")
+	resp.Body.Close()
+	s.Equal(http.StatusNotFound, resp.StatusCode, "admin endpoints are disabled by default")
+
+	putLevel := func(body string) (int, logger.LevelResponse) {
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodPut, "http://"+beServer1.addr+logger.AdminLogLevelPath, strings.NewReader(body))
+		s.Require().NoError(err, "level req")
+		resp, err := beServer1.testServer.Client().Do(req)
+		s.Require().NoError(err, "level do")
+		defer resp.Body.Close()
+		levels := logger.LevelResponse{}
+		if resp.StatusCode == http.StatusOK {
+			s.NoError(json.NewDecoder(resp.Body).Decode(&levels), "level response")
+		}
+
+		return resp.StatusCode, levels
+	}
+
+	levels := logger.LevelResponse{}
+	s.NoError(json.Unmarshal([]byte(s.getText(beServer1, logger.AdminLogLevelPath, "")), &levels), "get levels")
+	s.Equal("info", levels.Levels["backend"], "initial level")
+
+	status, levels := putLevel(`{"name":"backend","level":"trace","revertAfter":"200ms"}`)
+	s.Equal(http.StatusOK, status, "set level")
+	s.Equal("trace", levels.Levels["backend"], "changed level")
+	s.True(logger.GetLogger("backend").V(2).Enabled(), "trace enabled")
+	s.Eventually(func() bool {
+		return logger.GetLevels()["backend"] == "info"
+	}, 2*time.Second, 50*time.Millisecond, "reverted level")
+
+	status, levels = putLevel(`{"level":"debug"}`)
+	s.Equal(http.StatusOK, status, "set all levels")
+	for name, level := range levels.Levels {
+		s.Equal("debug", level, name)
+	}
+
+	status, _ = putLevel(`{"name":"nobody","level":"debug"}`)
+	s.Equal(http.StatusNotFound, status, "unknown logger")
+	status, _ = putLevel(`{"name":"backend","level":"loud"}`)
+	s.Equal(http.StatusBadRequest, status, "invalid level")
+	status, _ = putLevel(`{"name":"backend","level":"info","revertAfter":"soon"}`)
+	s.Equal(http.StatusBadRequest, status, "invalid revertAfter")
+}
+
+func (s *E2ETestSuite) TestMetrics() {
+	log := logger.GetLogger(s.T().Name())
+	tracing.SetErrorHandlerLogger(&log)
+	var runTestServer runTestServerType = runTestServerCmd
+
+	beServer1 := runTestServer("backend", "backend-1", &internal.BackendConfig{}, []string{"PONG_1"}, internal.NewBackendService, log)
+	defer beServer1.cancel()
+	feServer1 := runTestServer("frontend", "frontend", &internal.FrontendConfig{}, frontendArgs(), internal.NewFrontendService, log)
+	defer feServer1.cancel()
+
+	s.sendPingFrontend(feServer1, []string{beServer1.addr, "127.0.0.1:1"}, log)
+
+	feMetrics := s.getText(feServer1, tracing.MetricsPath, "")
+	s.Regexp(`http_server_request_count_total\{[^}]*http_route="/proxy",http_status_code="502"[^}]*\} 1`, feMetrics, "frontend requests")
+	s.Regexp(`http_server_error_count_total\{[^}]*http_route="/proxy"[^}]*\} 1`, feMetrics, "frontend errors")
+	s.Regexp(`http_server_duration_milliseconds_count\{[^}]*http_route="/proxy"[^}]*\} 1`, feMetrics, "frontend duration")
+	s.Regexp(`http_client_request_count_total\{[^}]*http_status_code="200"[^}]*\} 1`, feMetrics, "frontend client requests")
+	s.Regexp(`http_client_error_count_total\{[^}]*http_method="GET"[^}]*\} 1`, feMetrics, "frontend client errors")
+	s.NotContains(feMetrics, "net_peer_name", "no peer host name label")
+
+	beMetrics := s.getText(beServer1, tracing.MetricsPath, "")
+	s.Regexp(`http_server_request_count_total\{[^}]*http_route="/ping",http_status_code="200"[^}]*\} 1`, beMetrics, "backend requests")
+	s.NotContains(beMetrics, tracing.ExemplarKeyTraceID, "no exemplars in Prometheus text format")
+
+	feOpenMetrics := s.getText(feServer1, tracing.MetricsPath, "application/openmetrics-text; version=0.0.1")
+	exemplars := regexp.MustCompile(
+		`http_server_duration_milliseconds_bucket\{http_method="GET",http_route="/proxy",http_status_code="502",le="[^"]+"\} 1 `+
+			`# \{(span_id="[0-9a-f]{16}",?|trace_id="[0-9a-f]{32}",?){2}\} [0-9.e+-]+ [0-9.e+-]+`,
+	).FindAllStringSubmatch(feOpenMetrics, -1)
+	s.Len(exemplars, 1, "frontend exemplar")
+	s.Contains(feOpenMetrics, "# EOF", "OpenMetrics format")
+}
+
 func (s *E2ETestSuite) TestMoreBackendFromFrontend() {
 	log := logger.GetLogger(s.T().Name())
 	tracing.SetErrorHandlerLogger(&log)
@@ -51,7 +236,7 @@ func (s *E2ETestSuite) TestMoreBackendFromFrontend() {
 	defer beServer1.cancel()
 	beServer2 := runTestServer("backend", "backend-2", &internal.BackendConfig{}, []string{"PONG_2"}, internal.NewBackendService, log)
 	defer beServer2.cancel()
-	feServer1 := runTestServer("frontend", "frontend", &internal.FrontendConfig{}, []string{}, internal.NewFrontendService, log)
+	feServer1 := runTestServer("frontend", "frontend", &internal.FrontendConfig{}, frontendArgs(), internal.NewFrontendService, log)
 	defer feServer1.cancel()
 
 	s.sendPingFrontend(feServer1, []string{beServer1.addr}, log)
@@ -60,6 +245,19 @@ func (s *E2ETestSuite) TestMoreBackendFromFrontend() {
 	time.Sleep(1 * time.Second)
 }
 
+// sendProxy sends the URLs to the /proxy endpoint of the frontend (legacy text mode)
+func (s *E2ETestSuite) sendProxy(feServer *TestServer, beURLs []string) (int, string) {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "http://"+feServer.addr+"/proxy", strings.NewReader(strings.Join(beURLs, " ")))
+	s.Require().NoError(err, "proxy req")
+	resp, err := feServer.testServer.Client().Do(req)
+	s.Require().NoError(err, "proxy do")
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	s.Require().NoError(err, "proxy body")
+
+	return resp.StatusCode, string(body)
+}
+
 func (s *E2ETestSuite) sendPingFrontend(feServer *TestServer, beServerAddrs []string, log logr.Logger) {
 	for a := range beServerAddrs {
 		beServerAddrs[a] = "http://" + beServerAddrs[a] + "/ping"
@@ -83,7 +281,7 @@ func (s *E2ETestSuite) TestMoreBackendFromClient() {
 	defer beServer1.cancel()
 	beServer2 := runTestServer("backend", "backend-2", &internal.BackendConfig{}, []string{"PONG_2"}, internal.NewBackendService, log)
 	defer beServer2.cancel()
-	feServer1 := runTestServer("frontend", "frontend", &internal.FrontendConfig{}, []string{}, internal.NewFrontendService, log)
+	feServer1 := runTestServer("frontend", "frontend", &internal.FrontendConfig{}, frontendArgs(), internal.NewFrontendService, log)
 	defer feServer1.cancel()
 
 	runTestClient("client", "client-1", feServer1.addr, "http://"+beServer1.addr+"/ping", "http://"+beServer2.addr+"/ping", "http://"+beServer2.addr+"/ping")
@@ -91,6 +289,1032 @@ func (s *E2ETestSuite) TestMoreBackendFromClient() {
 	time.Sleep(1 * time.Second)
 }
 
+func (s *E2ETestSuite) TestBaggageAttributes() {
+	log := logger.GetLogger(s.T().Name())
+	tracing.SetErrorHandlerLogger(&log)
+	var runTestServer runTestServerType = runTestServerCmd
+
+	beServer1 := runTestServer("backend", "backend-1", &internal.BackendConfig{},
+		[]string{"PONG_1", "--spanStoreSize", "100", "--baggageAttributes", tracing.BaggageKeyID + "," + tracing.BaggageKeyCommand}, internal.NewBackendService, log,
+	)
+	defer beServer1.cancel()
+	feServer1 := runTestServer("frontend", "frontend", &internal.FrontendConfig{}, frontendArgs("--spanStoreSize", "100"), internal.NewFrontendService, log)
+	defer feServer1.cancel()
+
+	s.sendPingFrontend(feServer1, []string{beServer1.addr}, log)
+
+	feTraces := struct {
+		Traces []tracing.TraceSummary `json:"traces"`
+	}{}
+	s.getJSON(feServer1, "/debug/traces", &feTraces)
+	s.Require().Len(feTraces.Traces, 1, "frontend traces")
+	feTraceTree := struct {
+		Spans []*tracing.SpanNode `json:"spans"`
+	}{}
+	s.getJSON(feServer1, "/debug/traces/"+feTraces.Traces[0].TraceID, &feTraceTree)
+	s.Require().Len(feTraceTree.Spans, 1, "frontend root spans")
+	s.NotContains(feTraceTree.Spans[0].Attributes, tracing.DefaultBaggageAttributePrefix+tracing.BaggageKeyCommand, "baggage copy is disabled by default")
+
+	traces := struct {
+		Traces []tracing.TraceSummary `json:"traces"`
+	}{}
+	s.getJSON(beServer1, "/debug/traces", &traces)
+	s.Require().Len(traces.Traces, 1, "backend traces")
+	traceTree := struct {
+		Spans []*tracing.SpanNode `json:"spans"`
+	}{}
+	s.getJSON(beServer1, "/debug/traces/"+traces.Traces[0].TraceID, &traceTree)
+	s.Require().Len(traceTree.Spans, 1, "backend root spans")
+	s.Equal(strconv.Itoa(os.Getpid()), traceTree.Spans[0].Attributes[tracing.DefaultBaggageAttributePrefix+tracing.BaggageKeyID], "baggage from the frontend")
+	s.Contains(traceTree.Spans[0].Attributes, tracing.DefaultBaggageAttributePrefix+tracing.BaggageKeyCommand, "baggage from the frontend")
+}
+
+func (s *E2ETestSuite) TestDebugTraces() {
+	log := logger.GetLogger(s.T().Name())
+	tracing.SetErrorHandlerLogger(&log)
+	var runTestServer runTestServerType = runTestServerCmd
+
+	beServer1 := runTestServer("backend", "backend-1", &internal.BackendConfig{}, []string{"PONG_1", "--spanStoreSize", "100"}, internal.NewBackendService, log)
+	defer beServer1.cancel()
+	feServer1 := runTestServer("frontend", "frontend", &internal.FrontendConfig{}, frontendArgs("--spanStoreSize", "100"), internal.NewFrontendService, log)
+	defer feServer1.cancel()
+
+	s.sendPingFrontend(feServer1, []string{beServer1.addr}, log)
+
+	traces := struct {
+		Traces []tracing.TraceSummary `json:"traces"`
+	}{}
+	s.getJSON(feServer1, "/debug/traces", &traces)
+	s.Require().Len(traces.Traces, 1, "frontend traces")
+	s.Equal("frontend.opentracing-example", traces.Traces[0].Services[0], "frontend service")
+
+	traceTree := struct {
+		Spans []*tracing.SpanNode `json:"spans"`
+	}{}
+	s.getJSON(beServer1, "/debug/traces/"+traces.Traces[0].TraceID, &traceTree)
+	s.Require().Len(traceTree.Spans, 1, "backend root spans")
+	s.True(traceTree.Spans[0].RemoteParent, "backend parent is the frontend")
+}
+
+func (s *E2ETestSuite) TestExportQueue() {
+	log := logger.GetLogger(s.T().Name())
+	tracing.SetErrorHandlerLogger(&log)
+	var runTestServer runTestServerType = runTestServerCmd
+	receiver := newOtlpReceiver()
+	defer receiver.server.Close()
+	receiver.setFailing(true)
+	queueDir := s.T().TempDir()
+
+	beServer1 := runTestServer("backend", "backend-1", &internal.BackendConfig{}, []string{"PONG_1"}, internal.NewBackendService, log)
+	defer beServer1.cancel()
+	feServer1 := runTestServer("frontend", "frontend", &internal.FrontendConfig{}, frontendArgs(
+		"--exporterURL", "otlp+json://"+receiver.server.Listener.Addr().String(),
+		"--exportQueueDir", queueDir, "--exportQueueRetryMin", "100ms", "--exportQueueRetryMax", "200ms",
+		"--exportBatchTimeout", "100ms",
+	), internal.NewFrontendService, log)
+	defer feServer1.cancel()
+
+	s.sendPingFrontend(feServer1, []string{beServer1.addr}, log)
+	s.Eventually(func() bool {
+		files, err := os.ReadDir(queueDir)
+
+		return err == nil && len(files) > 0
+	}, 5*time.Second, 100*time.Millisecond, "spooled batches")
+	s.Empty(receiver.traceIDs(), "collector is down")
+
+	receiver.setFailing(false)
+	s.Eventually(func() bool {
+		return len(receiver.traceIDs()) == 1
+	}, 5*time.Second, 100*time.Millisecond, "replayed trace")
+	s.Eventually(func() bool {
+		files, err := os.ReadDir(queueDir)
+
+		return err == nil && len(files) == 0
+	}, 5*time.Second, 100*time.Millisecond, "empty queue dir")
+}
+
+func (s *E2ETestSuite) TestOpenTracingBridge() {
+	log := logger.GetLogger(s.T().Name())
+	tracing.SetErrorHandlerLogger(&log)
+	var runTestServer runTestServerType = runTestServerCmd
+
+	beServer1 := runTestServer("backend", "backend-1", &internal.BackendConfig{},
+		[]string{"PONG_1", "--spanStoreSize", "100", "--openTracingBridge"}, internal.NewBackendService, log,
+	)
+	defer beServer1.cancel()
+	s.IsType(&otbridge.BridgeTracer{}, opentracing.GlobalTracer(), "bridge is installed")
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "http://"+beServer1.addr+"/ping", http.NoBody)
+	s.Require().NoError(err, "ping req")
+	resp, err := beServer1.testServer.Client().Do(req)
+	s.Require().NoError(err, "ping do")
+	resp.Body.Close()
+
+	traces := struct {
+		Traces []tracing.TraceSummary `json:"traces"`
+	}{}
+	s.getJSON(beServer1, "/debug/traces", &traces)
+	s.Require().Len(traces.Traces, 1, "backend traces")
+	s.Equal(2, traces.Traces[0].SpanCount, "server and OpenTracing spans")
+
+	traceTree := struct {
+		Spans []*tracing.SpanNode `json:"spans"`
+	}{}
+	s.getJSON(beServer1, "/debug/traces/"+traces.Traces[0].TraceID, &traceTree)
+	s.Require().Len(traceTree.Spans, 1, "backend root spans")
+	s.Require().Len(traceTree.Spans[0].Children, 1, "OpenTracing span")
+	s.Equal("buildResponse", traceTree.Spans[0].Children[0].Name, "OpenTracing span name")
+	s.Equal("PONG_1", traceTree.Spans[0].Children[0].Attributes["response.prefix"], "OpenTracing tag")
+
+	beServer1.cancel()
+	s.Eventually(func() bool {
+		_, is := opentracing.GlobalTracer().(opentracing.NoopTracer)
+
+		return is
+	}, 5*time.Second, 100*time.Millisecond, "bridge is uninstalled")
+}
+
+func (s *E2ETestSuite) TestPropagators() {
+	log := logger.GetLogger(s.T().Name())
+	tracing.SetErrorHandlerLogger(&log)
+	var runTestServer runTestServerType = runTestServerCmd
+
+	beServer1 := runTestServer("backend", "backend-1", &internal.BackendConfig{},
+		[]string{"PONG_1", "--spanStoreSize", "100", "--propagators", "tracecontext,jaeger"}, internal.NewBackendService, log,
+	)
+	defer beServer1.cancel()
+
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "http://"+beServer1.addr+"/ping", http.NoBody)
+	s.Require().NoError(err, "ping req")
+	req.Header.Set("uber-trace-id", traceID+":00f067aa0ba902b7:0:1")
+	resp, err := beServer1.testServer.Client().Do(req)
+	s.Require().NoError(err, "ping do")
+	resp.Body.Close()
+
+	traceTree := struct {
+		Spans []*tracing.SpanNode `json:"spans"`
+	}{}
+	s.getJSON(beServer1, "/debug/traces/"+traceID, &traceTree)
+	s.Require().Len(traceTree.Spans, 1, "backend root spans")
+	s.Equal("00f067aa0ba902b7", traceTree.Spans[0].ParentSpanID, "parent from uber-trace-id")
+	s.Contains(otel.GetTextMapPropagator().Fields(), "uber-trace-id", "global propagator")
+}
+
+func (s *E2ETestSuite) TestProxyFanOut() {
+	log := logger.GetLogger(s.T().Name())
+	tracing.SetErrorHandlerLogger(&log)
+	var runTestServer runTestServerType = runTestServerCmd
+
+	slowServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delay, _ := time.ParseDuration(r.URL.Query().Get("delay")) //nolint:errcheck // test
+		time.Sleep(delay)
+		w.Write([]byte("SLOW_" + r.URL.Query().Get("delay"))) //nolint:errcheck,gosec // test
+	}))
+	defer slowServer.Close()
+	feServer1 := runTestServer("frontend", "frontend", &internal.FrontendConfig{},
+		frontendArgs("--spanStoreSize", "100", "--maxParallel", "3", "--backendTimeout", "500ms"), internal.NewFrontendService, log,
+	)
+	defer feServer1.cancel()
+
+	status, body := s.sendProxy(feServer1, []string{
+		slowServer.URL + "/?delay=300ms", slowServer.URL + "/?delay=200ms", slowServer.URL + "/?delay=100ms",
+	})
+	s.Equal(http.StatusOK, status, "all succeeded")
+	s.Equal("SLOW_300ms SLOW_200ms SLOW_100ms", body, "results in order")
+
+	traces := struct {
+		Traces []tracing.TraceSummary `json:"traces"`
+	}{}
+	s.getJSON(feServer1, "/debug/traces", &traces)
+	s.Require().Len(traces.Traces, 1, "frontend traces")
+	traceTree := struct {
+		Spans []*tracing.SpanNode `json:"spans"`
+	}{}
+	s.getJSON(feServer1, "/debug/traces/"+traces.Traces[0].TraceID, &traceTree)
+	s.Require().Len(traceTree.Spans, 1, "frontend root spans")
+	clientSpans := traceTree.Spans[0].Children
+	s.Require().Len(clientSpans, 3, "sibling client spans")
+	for _, a := range clientSpans {
+		for _, b := range clientSpans {
+			s.True(a.StartTime.Before(b.StartTime.Add(b.Duration)), "overlapping client spans")
+		}
+	}
+
+	status, body = s.sendProxy(feServer1, []string{slowServer.URL + "/?delay=1s", slowServer.URL + "/?delay=10ms"})
+	s.Equal(http.StatusBadGateway, status, "partial result")
+	lines := strings.Split(body, "\n")
+	s.Require().Len(lines, 2, "partial result lines")
+	s.Equal([]string{"", "SLOW_10ms"}, strings.Split(lines[0], " "), "results in position")
+	s.True(strings.HasPrefix(lines[1], "call 0: "), "position of the failed call")
+	s.Contains(lines[1], "deadline exceeded", "backend timeout")
+}
+
+func (s *E2ETestSuite) TestProxyJSON() {
+	log := logger.GetLogger(s.T().Name())
+	tracing.SetErrorHandlerLogger(&log)
+	var runTestServer runTestServerType = runTestServerCmd
+
+	echoServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delay, _ := time.ParseDuration(r.URL.Query().Get("delay")) //nolint:errcheck // test
+		time.Sleep(delay)
+		if r.URL.Query().Has("fail") {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		w.Write([]byte(r.Method + " " + r.Header.Get("X-Test"))) //nolint:errcheck,gosec // test
+	}))
+	defer echoServer.Close()
+	feServer1 := runTestServer("frontend", "frontend", &internal.FrontendConfig{},
+		frontendArgs("--spanStoreSize", "100"), internal.NewFrontendService, log,
+	)
+	defer feServer1.cancel()
+
+	status, response := s.sendProxyJSON(feServer1, `{"version":"v1","calls":[`+
+		`{"target":"`+echoServer.URL+`/","method":"PUT","headers":{"X-Test":"hello"}},`+
+		`{"target":"`+echoServer.URL+`/?fail"},`+
+		`{"target":"`+echoServer.URL+`/?delay=1s","timeout":"100ms"}]}`)
+	s.Equal(http.StatusBadGateway, status, "partial result")
+	s.Equal(model.ProxyAPIVersion, response.Version, "version")
+	s.Require().Len(response.Results, 3, "results")
+
+	s.Equal(http.StatusOK, response.Results[0].Status, "status")
+	s.Equal("PUT hello", response.Results[0].Body, "method and headers")
+	s.Empty(response.Results[0].Error, "no error")
+	s.Equal(http.StatusServiceUnavailable, response.Results[1].Status, "error status")
+	s.Equal("GET ", response.Results[1].Body, "error body")
+	s.NotEmpty(response.Results[1].Error, "error status")
+	s.Zero(response.Results[2].Status, "no response")
+	s.Contains(response.Results[2].Error, "deadline exceeded", "call timeout")
+	s.Less(time.Duration(response.Results[2].Latency), 900*time.Millisecond, "call timeout")
+
+	traces := struct {
+		Traces []tracing.TraceSummary `json:"traces"`
+	}{}
+	s.getJSON(feServer1, "/debug/traces", &traces)
+	s.Require().Len(traces.Traces, 1, "frontend traces")
+	traceTree := struct {
+		Spans []*tracing.SpanNode `json:"spans"`
+	}{}
+	s.getJSON(feServer1, "/debug/traces/"+traces.Traces[0].TraceID, &traceTree)
+	s.Require().Len(traceTree.Spans, 1, "frontend root spans")
+	childSpanIDs := map[string]bool{}
+	for _, child := range traceTree.Spans[0].Children {
+		childSpanIDs[child.SpanID] = true
+	}
+	for r, result := range response.Results {
+		s.True(childSpanIDs[result.SpanID], "child span ID of result %d", r)
+	}
+
+	status, response = s.sendProxyJSON(feServer1, `{"version":"v0","calls":[{"target":"`+echoServer.URL+`/"}]}`)
+	s.Equal(http.StatusBadRequest, status, "unsupported version")
+	s.Contains(response.Error, "unsupported version", "version error")
+	status, response = s.sendProxyJSON(feServer1, `{"version":"v1","calls":[{"target":"`+echoServer.URL+`/","timeout":"soon"}]}`)
+	s.Equal(http.StatusBadRequest, status, "invalid timeout")
+	s.NotEmpty(response.Error, "timeout error")
+	deepCall := `{"target":"` + echoServer.URL + `/"}`
+	for d := 0; d < model.MaxCallDepth; d++ {
+		deepCall = `{"target":"` + echoServer.URL + `/proxy","calls":[` + deepCall + `]}`
+	}
+	status, response = s.sendProxyJSON(feServer1, `{"version":"v1","calls":[`+deepCall+`]}`)
+	s.Equal(http.StatusBadRequest, status, "too deep call tree")
+	s.Contains(response.Error, "call tree is deeper than", "call tree depth error")
+	manyCalls := strings.Repeat(`{"target":"`+echoServer.URL+`/"},`, model.MaxCalls)
+	status, response = s.sendProxyJSON(feServer1, `{"version":"v1","calls":[`+manyCalls+`{"target":"`+echoServer.URL+`/"}]}`)
+	s.Equal(http.StatusBadRequest, status, "too many calls")
+	s.Contains(response.Error, "too many calls", "call count error")
+	status, response = s.sendProxyJSON(feServer1, `{"version":"v1","calls":[{"target":"`+echoServer.URL+`/"}]}`+strings.Repeat(" ", 1<<20))
+	s.Equal(http.StatusRequestEntityTooLarge, status, "too large request")
+	s.Contains(response.Error, internal.ErrProxyRequestLarge.Error(), "too large request error")
+
+	status, body := s.sendProxy(feServer1, []string{echoServer.URL + "/"})
+	s.Equal(http.StatusOK, status, "legacy text mode")
+	s.Equal("GET ", body, "legacy text body")
+}
+
+func (s *E2ETestSuite) TestProxyCallTree() {
+	log := logger.GetLogger(s.T().Name())
+	tracing.SetErrorHandlerLogger(&log)
+	var runTestServer runTestServerType = runTestServerCmd
+
+	beServer1 := runTestServer("backend", "backend-1", &internal.BackendConfig{}, []string{"PONG_1", "--spanStoreSize", "100"}, internal.NewBackendService, log)
+	defer beServer1.cancel()
+	beServer2 := runTestServer("backend", "backend-2", &internal.BackendConfig{}, []string{"PONG_2", "--spanStoreSize", "100"}, internal.NewBackendService, log)
+	defer beServer2.cancel()
+	feServers := []*TestServer{}
+	for _, instance := range []string{"frontend-1", "frontend-2", "frontend-3"} {
+		feServer := runTestServer("frontend", instance, &internal.FrontendConfig{}, frontendArgs("--spanStoreSize", "100"), internal.NewFrontendService, log)
+		defer feServer.cancel()
+		feServers = append(feServers, feServer)
+	}
+
+	// frontend-1 → frontend-2 → [backend-1, frontend-3 → backend-2]
+	status, response := s.sendProxyJSON(feServers[0], `{"version":"v1","calls":[{"target":"http://`+feServers[1].addr+`/proxy","calls":[`+
+		`{"target":"http://`+beServer1.addr+`/ping"},`+
+		`{"target":"http://`+feServers[2].addr+`/proxy","calls":[{"target":"http://`+beServer2.addr+`/ping"}]}]}]}`)
+	s.Equal(http.StatusOK, status, "call tree")
+	s.Require().Len(response.Results, 1, "frontend-2 result")
+	s.Empty(response.Results[0].Body, "nested results instead of body")
+	s.Require().Len(response.Results[0].Results, 2, "frontend-2 results")
+	s.True(strings.HasPrefix(response.Results[0].Results[0].Body, "PONG_1"), "backend-1 result")
+	s.Require().Len(response.Results[0].Results[1].Results, 1, "frontend-3 results")
+	s.True(strings.HasPrefix(response.Results[0].Results[1].Results[0].Body, "PONG_2"), "backend-2 result")
+
+	traceIDs := func(server *TestServer) []string {
+		traces := struct {
+			Traces []tracing.TraceSummary `json:"traces"`
+		}{}
+		s.getJSON(server, "/debug/traces", &traces)
+		ids := []string{}
+		for _, trace := range traces.Traces {
+			ids = append(ids, trace.TraceID)
+		}
+
+		return ids
+	}
+	feTraceIDs := traceIDs(feServers[0])
+	s.Require().Len(feTraceIDs, 1, "frontend-1 traces")
+	for _, server := range []*TestServer{feServers[1], feServers[2], beServer1, beServer2} {
+		s.Equal(feTraceIDs, traceIDs(server), "same trace at every hop")
+	}
+	traceTree := struct {
+		Spans []*tracing.SpanNode `json:"spans"`
+	}{}
+	s.getJSON(beServer2, "/debug/traces/"+feTraceIDs[0], &traceTree)
+	s.Require().Len(traceTree.Spans, 1, "backend-2 root spans")
+	s.Equal(response.Results[0].Results[1].Results[0].SpanID, traceTree.Spans[0].ParentSpanID, "parent is the client span of frontend-3")
+
+	scenario := filepath.Join(s.T().TempDir(), "scenario.yaml")
+	s.Require().NoError(os.WriteFile(scenario, []byte(`version: v1
+calls:
+  - target: http://`+feServers[1].addr+`/proxy
+    calls:
+      - target: http://`+feServers[2].addr+`/proxy
+        timeout: 5s
+        calls:
+          - target: http://`+beServer2.addr+`/ping
+`), 0o600), "scenario file")
+	runTestClient("client", "client-1", feServers[0].addr, "--scenario", scenario)
+	s.Len(traceIDs(beServer2), 2, "client scenario trace")
+	s.Len(traceIDs(beServer1), 1, "backend-1 is not in the scenario")
+}
+
+func (s *E2ETestSuite) TestProxyRetry() {
+	log := logger.GetLogger(s.T().Name())
+	tracing.SetErrorHandlerLogger(&log)
+	var runTestServer runTestServerType = runTestServerCmd
+
+	counters := map[string]int{}
+	countersMu := sync.Mutex{}
+	flakyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		countersMu.Lock()
+		counters[r.URL.Path]++
+		count := counters[r.URL.Path]
+		countersMu.Unlock()
+		failures, _ := strconv.Atoi(r.URL.Query().Get("failures")) //nolint:errcheck // test
+		if count <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		w.Write([]byte("FLAKY_" + strconv.Itoa(count))) //nolint:errcheck,gosec // test
+	}))
+	defer flakyServer.Close()
+	feServer1 := runTestServer("frontend", "frontend", &internal.FrontendConfig{},
+		frontendArgs("--spanStoreSize", "100", "--retryMaxAttempts", "3", "--retryBackoff", "10ms", "--retryOn", "503"), internal.NewFrontendService, log,
+	)
+	defer feServer1.cancel()
+
+	status, response := s.sendProxyJSON(feServer1, `{"version":"v1","calls":[`+
+		`{"target":"`+flakyServer.URL+`/get?failures=2"},`+
+		`{"target":"`+flakyServer.URL+`/post?failures=2","method":"POST"},`+
+		`{"target":"`+flakyServer.URL+`/key?failures=1","method":"POST","headers":{"Idempotency-Key":"42"}},`+
+		`{"target":"`+flakyServer.URL+`/override?failures=5","retry":{"maxAttempts":2}},`+
+		`{"target":"`+flakyServer.URL+`/limit?failures=100","retry":{"maxAttempts":1000,"backoff":"1ms","maxBackoff":"1ms"}}]}`)
+	s.Equal(http.StatusBadGateway, status, "partial result")
+	s.Require().Len(response.Results, 5, "results")
+	s.Equal(http.StatusOK, response.Results[0].Status, "succeeded after retries")
+	s.Equal("FLAKY_3", response.Results[0].Body, "third attempt")
+	s.Equal(http.StatusServiceUnavailable, response.Results[1].Status, "non-idempotent is not retried")
+	s.Equal("FLAKY_2", response.Results[2].Body, "retried by Idempotency-Key")
+	s.Equal(http.StatusServiceUnavailable, response.Results[3].Status, "retry override")
+	s.Equal(http.StatusServiceUnavailable, response.Results[4].Status, "limited retry override")
+	countersMu.Lock()
+	s.Equal(map[string]int{"/get": 3, "/post": 1, "/key": 2, "/override": 2, "/limit": internal.MaxRetryAttempts}, counters, "attempts")
+	countersMu.Unlock()
+
+	traces := struct {
+		Traces []tracing.TraceSummary `json:"traces"`
+	}{}
+	s.getJSON(feServer1, "/debug/traces", &traces)
+	s.Require().Len(traces.Traces, 1, "frontend traces")
+	traceTree := struct {
+		Spans []*tracing.SpanNode `json:"spans"`
+	}{}
+	s.getJSON(feServer1, "/debug/traces/"+traces.Traces[0].TraceID, &traceTree)
+	s.Require().Len(traceTree.Spans, 1, "frontend root spans")
+	var retrySpan *tracing.SpanNode
+	for _, child := range traceTree.Spans[0].Children {
+		if child.SpanID == response.Results[0].SpanID {
+			retrySpan = child
+		}
+	}
+	s.Require().NotNil(retrySpan, "retry span")
+	s.Equal("Retry GET", retrySpan.Name, "retry span name")
+	s.Equal("Unset", retrySpan.StatusCode, "final outcome")
+	s.EqualValues(3, retrySpan.Attributes["retry.attempts"], "attempts")
+	s.Len(retrySpan.Events, 2, "retry events")
+	s.Require().Len(retrySpan.Children, 3, "attempt spans")
+	resendCounts := []interface{}{}
+	for _, attempt := range retrySpan.Children {
+		resendCounts = append(resendCounts, attempt.Attributes["http.resend_count"])
+	}
+	s.ElementsMatch([]interface{}{nil, 1.0, 2.0}, resendCounts, "resend counts")
+}
+
+func (s *E2ETestSuite) TestCircuitBreaker() {
+	log := logger.GetLogger(s.T().Name())
+	tracing.SetErrorHandlerLogger(&log)
+	var runTestServer runTestServerType = runTestServerCmd
+
+	var healthy, requests int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if delay, err := time.ParseDuration(r.URL.Query().Get("delay")); err == nil {
+			time.Sleep(delay)
+		}
+		if atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer backend.Close()
+	feServer1 := runTestServer("frontend", "frontend", &internal.FrontendConfig{},
+		frontendArgs("--spanStoreSize", "100", "--breakerFailures", "2", "--breakerOpenTimeout", "300ms", "--adminEndpoints"), internal.NewFrontendService, log,
+	)
+	defer feServer1.cancel()
+	host := strings.TrimPrefix(backend.URL, "http://")
+	request := `{"version":"v1","calls":[{"target":"` + backend.URL + `/"}]}`
+	breakers := func() []internal.BreakerState {
+		response := internal.BreakersResponse{}
+		s.getJSON(feServer1, internal.AdminBreakersPath, &response)
+
+		return response.Breakers
+	}
+	breakerEvents := func(span *tracing.SpanNode) []tracing.SpanEvent {
+		events := []tracing.SpanEvent{}
+		for _, event := range span.Events {
+			if strings.HasPrefix(event.Name, "circuit breaker ") {
+				events = append(events, event)
+			}
+		}
+
+		return events
+	}
+	findSpan := func(spanID string) (*tracing.SpanNode, *tracing.SpanNode) {
+		traces := struct {
+			Traces []tracing.TraceSummary `json:"traces"`
+		}{}
+		s.getJSON(feServer1, "/debug/traces", &traces)
+		for _, summary := range traces.Traces {
+			traceTree := struct {
+				Spans []*tracing.SpanNode `json:"spans"`
+			}{}
+			s.getJSON(feServer1, "/debug/traces/"+summary.TraceID, &traceTree)
+			for _, root := range traceTree.Spans {
+				for _, child := range root.Children {
+					if child.SpanID == spanID {
+						return root, child
+					}
+				}
+			}
+		}
+
+		return nil, nil
+	}
+
+	s.sendProxyJSON(feServer1, request)
+	s.Equal([]internal.BreakerState{{Host: host, State: internal.BreakerClosed, Failures: 1, Since: breakers()[0].Since}}, breakers(), "closed after 1 failure")
+	_, response := s.sendProxyJSON(feServer1, request)
+	s.Equal(http.StatusServiceUnavailable, response.Results[0].Status, "second failure")
+	s.Equal(internal.BreakerOpen, breakers()[0].State, "open after 2 failures")
+	root, _ := findSpan(response.Results[0].SpanID)
+	s.Require().NotNil(root, "server span")
+	openEvents := breakerEvents(root)
+	s.Require().Len(openEvents, 1, "state change event")
+	s.Equal("circuit breaker open", openEvents[0].Name, "open event")
+	s.Equal(host, openEvents[0].Attributes["breaker.host"], "event host")
+
+	start := time.Now()
+	status, response := s.sendProxyJSON(feServer1, request)
+	s.Less(time.Since(start), 200*time.Millisecond, "short-circuited")
+	s.Equal(http.StatusBadGateway, status, "short-circuit status")
+	s.Zero(response.Results[0].Status, "no response")
+	s.Contains(response.Results[0].Error, "circuit breaker is open", "short-circuit error")
+	s.EqualValues(2, atomic.LoadInt32(&requests), "backend is not called")
+	_, shortCircuit := findSpan(response.Results[0].SpanID)
+	s.Require().NotNil(shortCircuit, "short-circuit span")
+	s.Equal("client", shortCircuit.Kind, "short-circuit span kind")
+	s.Equal("Error", shortCircuit.StatusCode, "short-circuit span status")
+	s.Equal("circuit breaker is open", shortCircuit.StatusDesc, "short-circuit span description")
+	s.Equal(internal.BreakerOpen, shortCircuit.Attributes["breaker.state"], "short-circuit span state")
+
+	atomic.StoreInt32(&healthy, 1)
+	time.Sleep(350 * time.Millisecond)
+	status, response = s.sendProxyJSON(feServer1, request)
+	s.Equal(http.StatusOK, status, "half-open probe")
+	s.Equal(internal.BreakerClosed, breakers()[0].State, "closed after the probe")
+	root, _ = findSpan(response.Results[0].SpanID)
+	s.Require().NotNil(root, "probe server span")
+	eventNames := []string{}
+	for _, event := range breakerEvents(root) {
+		eventNames = append(eventNames, event.Name)
+	}
+	s.Equal([]string{"circuit breaker half-open", "circuit breaker closed"}, eventNames, "state change events")
+
+	for i := 0; i < 3; i++ {
+		_, response = s.sendProxyJSON(feServer1, `{"version":"v1","calls":[{"target":"`+backend.URL+`/?delay=200ms","timeout":"10ms"}]}`)
+		s.Contains(response.Results[0].Error, "deadline exceeded", "timeout of the call")
+	}
+	s.Equal(internal.BreakerClosed, breakers()[0].State, "timeout of the call is not a failure")
+	s.Zero(breakers()[0].Failures, "timeout of the call is not counted")
+
+	atomic.StoreInt32(&healthy, 0)
+	s.sendProxyJSON(feServer1, request)
+	s.sendProxyJSON(feServer1, request)
+	s.Equal(internal.BreakerOpen, breakers()[0].State, "open again")
+	atomic.StoreInt32(&healthy, 1)
+	time.Sleep(350 * time.Millisecond)
+	probeDone := make(chan int)
+	go func() {
+		status, _ := s.sendProxyJSON(feServer1, `{"version":"v1","calls":[{"target":"`+backend.URL+`/?delay=300ms"}]}`)
+		probeDone <- status
+	}()
+	s.Eventually(func() bool {
+		return breakers()[0].State == internal.BreakerHalfOpen
+	}, time.Second, 10*time.Millisecond, "half-open with a running probe")
+	_, response = s.sendProxyJSON(feServer1, request)
+	s.Contains(response.Results[0].Error, "circuit breaker is open", "probes are exhausted")
+	_, shortCircuit = findSpan(response.Results[0].SpanID)
+	s.Require().NotNil(shortCircuit, "half-open short-circuit span")
+	s.Equal(internal.BreakerHalfOpen, shortCircuit.Attributes["breaker.state"], "half-open short-circuit span state")
+	s.Equal(http.StatusOK, <-probeDone, "probe")
+}
+
+func (s *E2ETestSuite) TestTargetPolicy() {
+	log := logger.GetLogger(s.T().Name())
+	tracing.SetErrorHandlerLogger(&log)
+	var runTestServer runTestServerType = runTestServerCmd
+
+	var requests int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "http://169.254.169.254/latest/meta-data/", http.StatusFound)
+
+			return
+		}
+		w.Write([]byte("ALLOWED")) //nolint:errcheck,gosec // test
+	}))
+	defer backend.Close()
+	backendPort := backend.URL[strings.LastIndex(backend.URL, ":")+1:]
+	feServer1 := runTestServer("frontend", "frontend-1", &internal.FrontendConfig{},
+		frontendArgs("--spanStoreSize", "100", "--denyPorts", "22"), internal.NewFrontendService, log,
+	)
+	defer feServer1.cancel()
+	feServer2 := runTestServer("frontend", "frontend-2", &internal.FrontendConfig{},
+		[]string{}, internal.NewFrontendService, log,
+	)
+	defer feServer2.cancel()
+
+	status, response := s.sendProxyJSON(feServer1, `{"version":"v1","calls":[`+
+		`{"target":"`+backend.URL+`/"},`+
+		`{"target":"file:///etc/passwd"},`+
+		`{"target":"http://169.254.169.254/latest/meta-data/"},`+
+		`{"target":"http://metadata.google.internal/computeMetadata/v1/"},`+
+		`{"target":"http://Metadata.Google.Internal./computeMetadata/v1/"},`+
+		`{"target":"http://100.100.100.200/latest/meta-data/"},`+
+		`{"target":"http://127.0.0.1:22/"}]}`)
+	s.Equal(http.StatusForbidden, status, "rejected targets")
+	s.Empty(response.Results, "no calls")
+	s.EqualValues(0, atomic.LoadInt32(&requests), "allowed target is not called")
+	reasons := map[string]string{}
+	for _, rejection := range response.Rejected {
+		reasons[rejection.Target] = rejection.Reason
+	}
+	s.Len(reasons, 6, "rejected targets")
+	s.Contains(reasons["file:///etc/passwd"], `scheme "file" is not allowed`, "scheme")
+	s.Contains(reasons["http://169.254.169.254/latest/meta-data/"], "address 169.254.169.254 is denied", "CIDR")
+	s.Contains(reasons["http://metadata.google.internal/computeMetadata/v1/"], `host "metadata.google.internal" is denied`, "host")
+	s.Contains(reasons["http://Metadata.Google.Internal./computeMetadata/v1/"], `host "metadata.google.internal" is denied`, "trailing dot")
+	s.Contains(reasons["http://100.100.100.200/latest/meta-data/"], "address 100.100.100.200 is denied", "Alibaba Cloud metadata")
+	s.Contains(reasons["http://127.0.0.1:22/"], "port 22 is denied", "port")
+
+	traces := struct {
+		Traces []tracing.TraceSummary `json:"traces"`
+	}{}
+	s.getJSON(feServer1, "/debug/traces", &traces)
+	s.Require().Len(traces.Traces, 1, "frontend traces")
+	traceTree := struct {
+		Spans []*tracing.SpanNode `json:"spans"`
+	}{}
+	s.getJSON(feServer1, "/debug/traces/"+traces.Traces[0].TraceID, &traceTree)
+	s.Require().Len(traceTree.Spans, 1, "frontend root spans")
+	rejectedEvents := 0
+	for _, event := range traceTree.Spans[0].Events {
+		if event.Name == "target rejected" {
+			rejectedEvents++
+			s.Contains(reasons, event.Attributes["target.url"], "rejected target event")
+		}
+	}
+	s.Equal(6, rejectedEvents, "rejected target events")
+
+	status, response = s.sendProxyJSON(feServer1, `{"version":"v1","calls":[{"target":"`+backend.URL+`/redirect"}]}`)
+	s.Equal(http.StatusForbidden, status, "redirect to denied address")
+	s.Require().Len(response.Rejected, 1, "rejected redirect")
+	s.Contains(response.Rejected[0].Reason, "address 169.254.169.254 is denied", "redirect reason")
+
+	status, response = s.sendProxyJSON(feServer1, `{"version":"v1","calls":[{"target":"http://`+feServer2.addr+`/proxy","calls":[`+
+		`{"target":"http://169.254.169.254/latest/meta-data/"}]}]}`)
+	s.Equal(http.StatusForbidden, status, "denied nested target")
+	s.Empty(response.Results, "nested call is not sent")
+	s.Require().Len(response.Rejected, 1, "rejected nested target")
+	s.Equal("http://169.254.169.254/latest/meta-data/", response.Rejected[0].Target, "nested target")
+
+	status, response = s.sendProxyJSON(feServer2, `{"version":"v1","calls":[{"target":"`+backend.URL+`/"}]}`)
+	s.Equal(http.StatusForbidden, status, "loopback is denied by default")
+	s.Empty(response.Results, "loopback call is not sent")
+	s.Require().Len(response.Rejected, 1, "rejected loopback target")
+	s.Contains(response.Rejected[0].Reason, "address 127.0.0.1 is denied (127.0.0.0/8)", "loopback reason")
+
+	status, response = s.sendProxyJSON(feServer2, `{"version":"v1","calls":[{"target":"http://localhost:`+backendPort+`/"}]}`)
+	s.Equal(http.StatusForbidden, status, "denied after DNS resolution")
+	s.Require().Len(response.Results, 1, "dialed call")
+	s.Require().Len(response.Rejected, 1, "rejected after DNS resolution")
+	s.Contains(response.Rejected[0].Reason, "is denied", "resolved address reason")
+	s.EqualValues(1, atomic.LoadInt32(&requests), "only the redirect was called")
+
+	textStatus, body := s.sendProxy(feServer1, []string{backend.URL + "/", "gopher://127.0.0.1:70/"})
+	s.Equal(http.StatusForbidden, textStatus, "legacy text mode")
+	s.Equal(`gopher://127.0.0.1:70/: scheme "gopher" is not allowed: outbound target denied`, body, "legacy text reasons")
+}
+
+// sendProxyJSON sends the JSON request to the /proxy endpoint of the frontend
+func (s *E2ETestSuite) sendProxyJSON(feServer *TestServer, request string) (int, model.ProxyResponse) {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, "http://"+feServer.addr+"/proxy", strings.NewReader(request))
+	s.Require().NoError(err, "proxy req")
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := feServer.testServer.Client().Do(req)
+	s.Require().NoError(err, "proxy do")
+	defer resp.Body.Close()
+	s.Equal("application/json", resp.Header.Get("Content-Type"), "content type")
+	response := model.ProxyResponse{}
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(&response), "proxy body")
+
+	return resp.StatusCode, response
+}
+
+func (s *E2ETestSuite) TestRedaction() {
+	log := logger.GetLogger(s.T().Name())
+	tracing.SetErrorHandlerLogger(&log)
+	var runTestServer runTestServerType = runTestServerCmd
+
+	beServer1 := runTestServer("backend", "backend-1", &internal.BackendConfig{},
+		[]string{"PONG_1", "--spanStoreSize", "100", "--redactQueryParams", "token", "--redactAttributes", "^http\\.user_agent$"}, internal.NewBackendService, log,
+	)
+	defer beServer1.cancel()
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "http://"+beServer1.addr+"/ping?token=secret&page=1", http.NoBody)
+	s.Require().NoError(err, "ping req")
+	resp, err := beServer1.testServer.Client().Do(req)
+	s.Require().NoError(err, "ping do")
+	resp.Body.Close()
+
+	traces := struct {
+		Traces []tracing.TraceSummary `json:"traces"`
+	}{}
+	s.getJSON(beServer1, "/debug/traces", &traces)
+	s.Require().Len(traces.Traces, 1, "backend traces")
+	s.Equal("IN HTTP GET /ping?token="+tracing.RedactedValue+"&page=1", traces.Traces[0].RootName, "span name")
+
+	traceTree := struct {
+		Spans []*tracing.SpanNode `json:"spans"`
+	}{}
+	s.getJSON(beServer1, "/debug/traces/"+traces.Traces[0].TraceID, &traceTree)
+	s.Require().Len(traceTree.Spans, 1, "backend root spans")
+	s.Equal(tracing.RedactedValue, traceTree.Spans[0].Attributes["http.user_agent"], "masked attribute")
+	s.NotContains(traceTree.Spans[0].Attributes["http.target"], "secret", "masked query parameter")
+}
+
+func (s *E2ETestSuite) TestResource() {
+	log := logger.GetLogger(s.T().Name())
+	tracing.SetErrorHandlerLogger(&log)
+	var runTestServer runTestServerType = runTestServerCmd
+	receiver := newOtlpReceiver()
+	defer receiver.server.Close()
+	s.T().Setenv("K8S_POD_NAME", "backend-0")
+	s.T().Setenv("K8S_NAMESPACE_NAME", "opentracing-example")
+
+	beServer1 := runTestServer("backend", "backend-1", &internal.BackendConfig{}, []string{"PONG_1",
+		"--exporterURL", "otlp+json://" + receiver.server.Listener.Addr().String(),
+		"--resourceAttr", "deployment.environment=e2e", "--exportBatchTimeout", "100ms",
+	}, internal.NewBackendService, log)
+	defer beServer1.cancel()
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "http://"+beServer1.addr+"/ping", http.NoBody)
+	s.Require().NoError(err, "ping req")
+	resp, err := beServer1.testServer.Client().Do(req)
+	s.Require().NoError(err, "ping do")
+	resp.Body.Close()
+
+	s.Require().Eventually(func() bool {
+		return len(receiver.traceIDs()) == 1
+	}, 5*time.Second, 100*time.Millisecond, "exported trace")
+	body := receiver.body()
+	for _, key := range []string{"k8s.pod.name", "k8s.namespace.name", "process.pid", "host.name", "os.type", "deployment.environment"} {
+		s.Contains(body, `"key":"`+key+`"`, "resource attribute")
+	}
+	s.Contains(body, `"stringValue":"backend-0"`, "pod name")
+	s.NotContains(body, `"key":"attrID"`, "legacy attribute")
+}
+
+func (s *E2ETestSuite) TestSamplerRules() {
+	log := logger.GetLogger(s.T().Name())
+	tracing.SetErrorHandlerLogger(&log)
+	var runTestServer runTestServerType = runTestServerCmd
+
+	beServer1 := runTestServer("backend", "backend-1", &internal.BackendConfig{}, []string{"PONG_1", "--spanStoreSize", "100"}, internal.NewBackendService, log)
+	defer beServer1.cancel()
+	feServer1 := runTestServer("frontend", "frontend", &internal.FrontendConfig{},
+		frontendArgs("--spanStoreSize", "100", "--samplerRules", "GET /proxy=always_off"), internal.NewFrontendService, log,
+	)
+	defer feServer1.cancel()
+
+	s.sendPingFrontend(feServer1, []string{beServer1.addr}, log)
+
+	traces := struct {
+		Traces []tracing.TraceSummary `json:"traces"`
+	}{}
+	s.getJSON(feServer1, "/debug/traces", &traces)
+	s.Empty(traces.Traces, "frontend traces")
+	s.getJSON(beServer1, "/debug/traces", &traces)
+	s.Empty(traces.Traces, "backend traces (parent based)")
+}
+
+func (s *E2ETestSuite) TestServerTiming() {
+	log := logger.GetLogger(s.T().Name())
+	tracing.SetErrorHandlerLogger(&log)
+	var runTestServer runTestServerType = runTestServerCmd
+
+	beServer1 := runTestServer("backend", "backend-1", &internal.BackendConfig{}, []string{"PONG_1"}, internal.NewBackendService, log)
+	defer beServer1.cancel()
+	feServer1 := runTestServer("frontend", "frontend", &internal.FrontendConfig{}, frontendArgs("--spanStoreSize", "100"), internal.NewFrontendService, log)
+	defer feServer1.cancel()
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "http://"+feServer1.addr+"/proxy",
+		strings.NewReader("http://"+beServer1.addr+"/ping"),
+	)
+	s.Require().NoError(err, "proxy req")
+	resp, err := feServer1.testServer.Client().Do(req)
+	s.Require().NoError(err, "proxy do")
+	resp.Body.Close()
+
+	traceID, _, ok := tracing.ParseTraceResponse(resp.Header.Get(tracing.HeaderTraceResponse))
+	s.Require().True(ok, "traceresponse header")
+	traces := struct {
+		Traces []tracing.TraceSummary `json:"traces"`
+	}{}
+	s.getJSON(feServer1, "/debug/traces", &traces)
+	s.Require().Len(traces.Traces, 1, "frontend traces")
+	s.Equal(traces.Traces[0].TraceID, traceID.String(), "trace ID")
+
+	serverTiming := resp.Header.Get(tracing.HeaderServerTiming)
+	s.Regexp(`^total;dur=[0-9.]+, span1;dur=[0-9.]+;desc="HTTP GET"$`, serverTiming, "Server-Timing header")
+}
+
+func (s *E2ETestSuite) TestTraceLogger() {
+	var linesMu sync.Mutex
+	lines := []map[string]interface{}{}
+	log := funcr.NewJSON(func(obj string) {
+		line := map[string]interface{}{}
+		s.NoError(json.Unmarshal([]byte(obj), &line), "log line")
+		linesMu.Lock()
+		defer linesMu.Unlock()
+		lines = append(lines, line)
+	}, funcr.Options{})
+
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSampler(sdktrace.AlwaysSample()))
+	defer tp.Shutdown(context.Background()) //nolint:errcheck // test
+	r := chi.NewRouter()
+	r.Use(chi_middleware.RequestLogger(&logger.ChiLogr{Logger: log}))
+	r.Group(func(r chi.Router) {
+		r.Use(tracing.ChiTracerMiddleware(tp.Tracer(s.T().Name()), propagation.TraceContext{}, "test", "test", log))
+		r.Get("/ping", func(w http.ResponseWriter, r *http.Request) {
+			logger.FromContext(r.Context(), log).Info("Handler")
+			w.Write([]byte("PONG")) //nolint:errcheck,gosec // test
+		})
+	})
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL + "/ping") //nolint:noctx // test
+	s.Require().NoError(err, "ping")
+	resp.Body.Close()
+	traceID, spanID, ok := tracing.ParseTraceResponse(resp.Header.Get(tracing.HeaderTraceResponse))
+	s.Require().True(ok, "traceresponse")
+
+	linesMu.Lock()
+	defer linesMu.Unlock()
+	correlated := map[string]bool{}
+	for _, line := range lines {
+		if line[logger.KeyTraceID] != nil {
+			s.Equal(traceID.String(), line[logger.KeyTraceID], "trace_id")
+			s.Equal(spanID.String(), line[logger.KeySpanID], "span_id")
+			s.Equal("01", line[logger.KeyTraceFlags], "trace_flags")
+			correlated[line["msg"].(string)] = true
+		}
+	}
+	s.Equal(map[string]bool{"Handler": true, "Chi": true}, correlated, "correlated lines")
+}
+
+func (s *E2ETestSuite) TestSpanMetrics() {
+	log := logger.GetLogger(s.T().Name())
+	tracing.SetErrorHandlerLogger(&log)
+	var runTestServer runTestServerType = runTestServerCmd
+
+	beServer1 := runTestServer("backend", "backend-1", &internal.BackendConfig{}, []string{"PONG_1", "--spanMetrics"}, internal.NewBackendService, log)
+	defer beServer1.cancel()
+	feServer1 := runTestServer("frontend", "frontend", &internal.FrontendConfig{}, frontendArgs("--spanMetrics"), internal.NewFrontendService, log)
+	defer feServer1.cancel()
+
+	runTestClient("client", "client-1", feServer1.addr, "http://"+beServer1.addr+"/ping")
+	s.sendPingFrontend(feServer1, []string{beServer1.addr, "127.0.0.1:1"}, log)
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "http://"+beServer1.addr+"/ping?token=1", http.NoBody)
+	s.Require().NoError(err, "ping req")
+	resp, err := beServer1.testServer.Client().Do(req)
+	s.Require().NoError(err, "ping do")
+	resp.Body.Close()
+
+	feMetrics := s.getText(feServer1, tracing.MetricsPath, "")
+	s.Regexp(`span_calls_total\{[^}]*service_name="frontend.opentracing-example",span_kind="server",span_name="GET /proxy",status_code="Error"[^}]*\} 1`, feMetrics, "frontend server span")
+	s.Regexp(`span_errors_total\{[^}]*service_name="frontend.opentracing-example",span_kind="server",span_name="GET /proxy",status_code="Error"[^}]*\} 1`, feMetrics, "frontend server error")
+	s.Regexp(`span_calls_total\{[^}]*service_name="frontend.opentracing-example",span_kind="client",span_name="HTTP GET",status_code="Unset"[^}]*\} 2`, feMetrics, "frontend client span")
+	s.Regexp(`span_duration_milliseconds_count\{[^}]*service_name="frontend.opentracing-example",span_kind="client",span_name="HTTP GET",status_code="Error"[^}]*\} 1`, feMetrics, "frontend client duration")
+	s.Regexp(`servicegraph_requests_total\{client="client.opentracing-example",[^}]*server="frontend.opentracing-example"\} 1`, feMetrics, "edge from client")
+	s.Regexp(`servicegraph_requests_failed_total\{client="unknown",[^}]*server="frontend.opentracing-example"\} 1`, feMetrics, "failed edge from unknown caller")
+	s.NotRegexp(`servicegraph_requests_failed_total\{client="client.opentracing-example"`, feMetrics, "no failed edge from client")
+
+	beMetrics := s.getText(beServer1, tracing.MetricsPath, "")
+	s.Regexp(`span_calls_total\{[^}]*service_name="backend.opentracing-example",span_kind="server",span_name="GET /ping",status_code="Unset"[^}]*\} 3`, beMetrics, "backend server span without query")
+	s.Regexp(`servicegraph_requests_total\{client="frontend.opentracing-example",[^}]*server="backend.opentracing-example"\} 2`, beMetrics, "edge from frontend")
+	s.Regexp(`servicegraph_requests_total\{client="unknown",[^}]*server="backend.opentracing-example"\} 1`, beMetrics, "edge from unknown caller")
+	s.NotContains(beMetrics, "servicegraph_requests_failed_total{", "no failed backend edges")
+}
+
+func (s *E2ETestSuite) TestSpanStatus() {
+	log := logger.GetLogger(s.T().Name())
+	tracing.SetErrorHandlerLogger(&log)
+	var runTestServer runTestServerType = runTestServerCmd
+
+	beServer1 := runTestServer("backend", "backend-1", &internal.BackendConfig{}, []string{"PONG_1"}, internal.NewBackendService, log)
+	defer beServer1.cancel()
+	feServer1 := runTestServer("frontend", "frontend", &internal.FrontendConfig{}, frontendArgs("--spanStoreSize", "100"), internal.NewFrontendService, log)
+	defer feServer1.cancel()
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "http://"+feServer1.addr+"/proxy",
+		strings.NewReader("http://"+beServer1.addr+"/missing"),
+	)
+	s.Require().NoError(err, "proxy req")
+	resp, err := feServer1.testServer.Client().Do(req)
+	s.Require().NoError(err, "proxy do")
+	resp.Body.Close()
+	s.Equal(http.StatusBadGateway, resp.StatusCode, "backend error")
+
+	traces := struct {
+		Traces []tracing.TraceSummary `json:"traces"`
+	}{}
+	s.getJSON(feServer1, "/debug/traces", &traces)
+	s.Require().Len(traces.Traces, 1, "frontend traces")
+	s.Equal(2, traces.Traces[0].ErrCount, "server and client span errors")
+
+	traceTree := struct {
+		Spans []*tracing.SpanNode `json:"spans"`
+	}{}
+	s.getJSON(feServer1, "/debug/traces/"+traces.Traces[0].TraceID, &traceTree)
+	s.Require().Len(traceTree.Spans, 1, "frontend root spans")
+	serverSpan := traceTree.Spans[0]
+	s.Equal("Error", serverSpan.StatusCode, "server span status")
+	s.Contains(serverSpan.StatusDesc, internal.ErrBackendResponse.Error(), "server span status description")
+	s.EqualValues(http.StatusBadGateway, serverSpan.Attributes["http.status_code"], "server span status code")
+	s.Require().NotEmpty(serverSpan.Events, "server span events")
+	exception := serverSpan.Events[len(serverSpan.Events)-1]
+	s.Equal("exception", exception.Name, "exception event")
+	s.Contains(exception.Attributes, "exception.stacktrace", "stack trace")
+	s.Require().Len(serverSpan.Children, 1, "client span")
+	s.Equal("Error", serverSpan.Children[0].StatusCode, "client span status")
+}
+
+func (s *E2ETestSuite) TestTailSampling() {
+	log := logger.GetLogger(s.T().Name())
+	tracing.SetErrorHandlerLogger(&log)
+	var runTestServer runTestServerType = runTestServerCmd
+	receiver := newOtlpReceiver()
+	defer receiver.server.Close()
+
+	beServer1 := runTestServer("backend", "backend-1", &internal.BackendConfig{}, []string{"PONG_1"}, internal.NewBackendService, log)
+	defer beServer1.cancel()
+	feServer1 := runTestServer("frontend", "frontend", &internal.FrontendConfig{}, frontendArgs(
+		"--exporterURL", "otlp+json://"+receiver.server.Listener.Addr().String(),
+		"--tailSampling", "--tailSamplingAttributes", "http.route=/never", "--exportBatchTimeout", "100ms",
+	), internal.NewFrontendService, log)
+	defer feServer1.cancel()
+
+	s.sendPingFrontend(feServer1, []string{beServer1.addr}, log)
+	s.sendPingFrontend(feServer1, []string{"127.0.0.1:1"}, log)
+	s.Eventually(func() bool {
+		return len(receiver.traceIDs()) > 0
+	}, 5*time.Second, 100*time.Millisecond, "trace with error is kept")
+	s.Len(receiver.traceIDs(), 1, "trace without error is dropped")
+}
+
+type otlpReceiver struct {
+	server  *httptest.Server
+	mu      sync.Mutex
+	ids     map[string]bool
+	bodies  []string
+	failing bool
+}
+
+// newOtlpReceiver starts an OTLP/HTTP JSON receiver, which collects the trace IDs
+func newOtlpReceiver() *otlpReceiver {
+	receiver := &otlpReceiver{ids: map[string]bool{}}
+	receiver.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		receiver.mu.Lock()
+		defer receiver.mu.Unlock()
+		if receiver.failing {
+			w.WriteHeader(http.StatusServiceUnavailable)
+
+			return
+		}
+		receiver.bodies = append(receiver.bodies, string(body))
+		for _, match := range otlpTraceIDRe.FindAllStringSubmatch(string(body), -1) {
+			receiver.ids[match[1]] = true
+		}
+	}))
+
+	return receiver
+}
+
+var otlpTraceIDRe = regexp.MustCompile(`"traceId":"([0-9a-f]+)"`)
+
+func (r *otlpReceiver) body() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return strings.Join(r.bodies, "\n")
+}
+
+// setFailing sets the receiver to answer 503 (collector outage)
+func (r *otlpReceiver) setFailing(failing bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failing = failing
+}
+
+func (r *otlpReceiver) traceIDs() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ids := []string{}
+	for id := range r.ids {
+		ids = append(ids, id)
+	}
+
+	return ids
+}
+
+func (s *E2ETestSuite) getText(server *TestServer, path string, accept string) string {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "http://"+server.addr+path, http.NoBody)
+	s.Require().NoError(err, "text req")
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	resp, err := server.testServer.Client().Do(req)
+	s.Require().NoError(err, "text do")
+	defer resp.Body.Close()
+	s.Require().Equal(http.StatusOK, resp.StatusCode, "text status")
+	body, err := io.ReadAll(resp.Body)
+	s.Require().NoError(err, "text body")
+
+	return string(body)
+}
+
+func (s *E2ETestSuite) getJSON(server *TestServer, path string, value interface{}) {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "http://"+server.addr+path, http.NoBody)
+	s.Require().NoError(err, "debug req")
+	resp, err := server.testServer.Client().Do(req)
+	s.Require().NoError(err, "debug do")
+	defer resp.Body.Close()
+	s.Require().Equal(http.StatusOK, resp.StatusCode, "debug status")
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(value), "debug body")
+}
+
 //nolint:deadcode,unused // old test
 func runTestServerService(typeName string, instance string, config internal.ConfigSetter, args []string, newService model.NewService, log logr.Logger) *TestServer {
 	server := &TestServer{
@@ -118,6 +1342,14 @@ func runTestServerService(typeName string, instance string, config internal.Conf
 	return server
 }
 
+// testDenyCIDRs are the default --denyCIDRs without the loopback and private addresses, see frontendArgs
+const testDenyCIDRs = "169.254.0.0/16,fe80::/10,fd00:ec2::254,100.100.100.200"
+
+// frontendArgs returns the frontend args, the loopback test servers are allowed as targets (denied by default)
+func frontendArgs(args ...string) []string {
+	return append([]string{"--denyCIDRs", testDenyCIDRs}, args...)
+}
+
 func runTestServerCmd(typeName string, instance string, config internal.ConfigSetter, args []string, newService model.NewService, log logr.Logger) *TestServer {
 	server := &TestServer{
 		testServer: httptest.NewUnstartedServer(nil),
@@ -127,6 +1359,7 @@ func runTestServerCmd(typeName string, instance string, config internal.ConfigSe
 	runner := TestServerRunner(server.testServer, started)
 	server.ctx, server.cancel = context.WithCancel(context.Background())
 	command := append([]string{typeName, "--listenaddr", server.addr, "--instance", invalidDomainNameRe.ReplaceAllString(instance, "-"), "--jaegerURL", "http://localhost:14268/api/traces"}, args...)
+	ResetFlags(cmd.RootCmd())
 	go func() {
 		cmd.Execute(server.ctx, command, runner)
 	}()
@@ -143,6 +1376,7 @@ func runTestClient(typeName string, instance string, addr string, args ...string
 		addr: addr,
 	}
 	server.ctx, server.cancel = context.WithCancel(context.Background())
+	ResetFlags(cmd.RootCmd())
 	cmd.Execute(server.ctx, append([]string{typeName, "--server", addr, "--instance", invalidDomainNameRe.ReplaceAllString(instance, "-")}, args...), nil)
 
 	return server
@@ -3,8 +3,13 @@ package test
 import (
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 
 	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
 	"github.com/pgillich/opentracing-example/internal/model"
 )
 
@@ -20,3 +25,38 @@ func TestServerRunner(server *httptest.Server, started chan struct{}) model.Serv
 		server.Close()
 	}
 }
+
+/*
+ResetFlags sets the default values of the flags, because cmd.Execute is called more times by the tests.
+The slice values are replaced by new ones, because a slice value appends after its first Set.
+*/
+func ResetFlags(command *cobra.Command) {
+	reset := func(flag *pflag.Flag) {
+		defaults := []string{}
+		if defValue := strings.Trim(flag.DefValue, "[]"); defValue != "" {
+			defaults = strings.Split(defValue, ",")
+		}
+		flags := pflag.NewFlagSet(flag.Name, pflag.ContinueOnError)
+		switch flag.Value.Type() {
+		case "stringSlice":
+			flags.StringSlice(flag.Name, defaults, flag.Usage)
+			flag.Value = flags.Lookup(flag.Name).Value
+		case "intSlice":
+			intDefaults := make([]int, 0, len(defaults))
+			for _, defValue := range defaults {
+				intDefault, _ := strconv.Atoi(defValue) //nolint:errcheck // default value
+				intDefaults = append(intDefaults, intDefault)
+			}
+			flags.IntSlice(flag.Name, intDefaults, flag.Usage)
+			flag.Value = flags.Lookup(flag.Name).Value
+		default:
+			flag.Value.Set(flag.DefValue) //nolint:errcheck,gosec // default value
+		}
+		flag.Changed = false
+	}
+	command.Flags().VisitAll(reset)
+	command.PersistentFlags().VisitAll(reset)
+	for _, child := range command.Commands() {
+		ResetFlags(child)
+	}
+}